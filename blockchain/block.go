@@ -2,10 +2,13 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/rsa"
-	"errors"
-	"math/big"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -16,14 +19,17 @@ type Block struct {
 	Difficulty uint8
 	Miner string
 	Signature []byte
-	TimeStamp string
+	TimeStamp int64
 	Transactions []Transaction
 	Mapping map[string]uint64
+	Coinbase string `json:",omitempty"`
+	SpecHash []byte `json:",omitempty"`
+	size int
 }
 
 func NewBlock(miner string, prevHash []byte) *Block {
 	return &Block{
-		Difficulty: DIFFICULTY,
+		Difficulty: Spec.Difficulty,
 		PrevHash: prevHash,
 		Miner: miner,
 		Mapping: make(map[string]uint64),
@@ -32,19 +38,19 @@ func NewBlock(miner string, prevHash []byte) *Block {
 
 func (block *Block) AddTransaction(chain *Blockchain, tx *Transaction) error {
 	if tx == nil {
-		return errors.New("tx is null")
+		return ErrNilTx
 	}
 	if tx.Value == 0 {
-		return errors.New("tx value = 0")
+		return ErrTxValue
 	}
-	if tx.Sender != STORAGE_CHAIN && len(block.Transactions) == TXS_LIMIT {
-		return errors.New("len tx = limit")
+	if tx.Sender != STORAGE_CHAIN && Spec.TxsLimit != 0 && len(block.Transactions) >= Spec.TxsLimit {
+		return fmt.Errorf("%w: %d transactions", ErrTxLimit, Spec.TxsLimit)
 	}
-	if tx.Sender != STORAGE_CHAIN && tx.Value > START_PERCENT && tx.ToStorage != STORAGE_REWARD {
-		return errors.New("storage reward pass")
+	if tx.Sender != STORAGE_CHAIN && tx.Value > Spec.StartPercent && tx.ToStorage != Spec.StorageReward {
+		return fmt.Errorf("%w: expected %d, got %d", ErrTxStorage, Spec.StorageReward, tx.ToStorage)
 	}
 	if !bytes.Equal(tx.PrevBlock, chain.LastHash()) {
-		return errors.New("prev block in tx /= last hash in chain")
+		return ErrTxPrevBlock
 	}
 	var balanceInChain uint64
 	balanceInTX := tx.Value + tx.ToStorage
@@ -54,34 +60,142 @@ func (block *Block) AddTransaction(chain *Blockchain, tx *Transaction) error {
 		balanceInChain = chain.Balance(tx.Sender, chain.Size())
 	}
 	if balanceInTX > balanceInChain {
-		return errors.New("insufficient funds")
+		return fmt.Errorf("%w: address %s: balance %d, needed %d",
+			ErrInsufficientFunds, tx.Sender, balanceInChain, balanceInTX)
 	}
+	if block.size == 0 {
+		block.size = block.Size()
+	}
+	saved := block.saveMapping(tx.Sender, tx.Receiver, STORAGE_CHAIN)
 	block.Mapping[tx.Sender] = balanceInChain - balanceInTX
 	block.addBalance(chain, tx.Receiver, tx.Value)
 	block.addBalance(chain, STORAGE_CHAIN, tx.ToStorage)
+	size := block.size + txSize(tx) + block.mappingGrowth(saved)
+	if tx.Sender != STORAGE_CHAIN && size > Spec.BlockSize-Spec.Reserve() {
+		block.restoreMapping(saved)
+		return fmt.Errorf("%w: %d bytes with %d reserved", ErrBlockSize, Spec.BlockSize, Spec.Reserve())
+	}
 	block.Transactions = append(block.Transactions, *tx)
+	block.size = size
 	return nil
 }
 
-func (block *Block) Accept(chain *Blockchain, user *User, ch chan bool) error {
-	if !block.transactionsIsValid(chain, chain.Size()) {
-		return errors.New("transactions is not valid")
+func (block *Block) Size() int {
+	return len(SerializeBlock(block))
+}
+
+// txSize and mappingGrowth bound what a transaction adds to the
+// serialized block, so templates do not reserialize every transaction.
+func txSize(tx *Transaction) int {
+	data, err := json.MarshalIndent(tx, "\t\t", "\t")
+	if err != nil {
+		return 0
+	}
+	return len(data) + ENTRY_OVERHEAD
+}
+
+func (block *Block) mappingGrowth(saved map[string]*uint64) int {
+	growth := 0
+	for addr, value := range saved {
+		digits := len(strconv.FormatUint(block.Mapping[addr], 10))
+		if value == nil {
+			growth += len(addr) + digits + ENTRY_OVERHEAD
+		} else {
+			growth += digits - len(strconv.FormatUint(*value, 10))
+		}
+	}
+	return growth
+}
+
+func (block *Block) saveMapping(addresses ...string) map[string]*uint64 {
+	saved := make(map[string]*uint64)
+	for _, addr := range addresses {
+		if value, ok := block.Mapping[addr]; ok {
+			saved[addr] = &value
+		} else {
+			saved[addr] = nil
+		}
+	}
+	return saved
+}
+
+func (block *Block) restoreMapping(saved map[string]*uint64) {
+	for addr, value := range saved {
+		if value == nil {
+			delete(block.Mapping, addr)
+		} else {
+			block.Mapping[addr] = *value
+		}
+	}
+}
+
+func (block *Block) Accept(ctx context.Context, chain *Blockchain, user *User) error {
+	err := block.Prepare(chain)
+	if err != nil {
+		return err
 	}
-	block.AddTransaction(chain, &Transaction{
+	for {
+		err = block.Stamp(ctx, user)
+		if err != nil {
+			return err
+		}
+		block.Nonce, err = block.proof(ctx)
+		if err == ErrNonceExhausted {
+			logger.Info("nonce space exhausted, rolling timestamp", "hash", Base64Encode(block.CurrHash))
+			continue
+		}
+		return err
+	}
+}
+
+func (block *Block) Prepare(chain *Blockchain) error {
+	err := block.AddTransaction(chain, &Transaction{
 		RandBytes: GenerateRandomBytes(RAND_BYTES),
 		PrevBlock: chain.LastHash(),
 		Sender:    STORAGE_CHAIN,
-		Receiver:  user.Address(),
-		Value:     STORAGE_REWARD,
+		Receiver:  block.RewardAddress(),
+		Value:     Spec.StorageReward,
 	})
-	block.TimeStamp = time.Now().Format(time.RFC3339)
-	block.CurrHash = block.hash()
+	if err != nil {
+		return err
+	}
+	block.TimeStamp = chain.MedianTimePast(chain.Size())
+	err = block.validateSize(NONCE_DIGITS + 2*base64.StdEncoding.EncodedLen(int(Spec.KeySize/8)))
+	if err != nil {
+		return err
+	}
+	return block.validateTransactions(chain, chain.Size(), true)
+}
+
+func (block *Block) Stamp(ctx context.Context, user *User) error {
+	stamp, err := nextTimeStamp(ctx, block.TimeStamp)
+	if err != nil {
+		return err
+	}
+	block.TimeStamp = stamp
+	block.CurrHash = block.Hash()
 	block.Signature = block.sign(user.Private())
-	block.Nonce = block.proof(ch)
-	return nil
+	return block.validateSize(NONCE_DIGITS)
+}
+
+func nextTimeStamp(ctx context.Context, floor int64) (int64, error) {
+	for {
+		now := time.Now().Unix()
+		if now > floor {
+			return now, nil
+		}
+		if floor+1 <= now+Spec.MaxFutureDrift {
+			return floor + 1, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Until(time.Now().Truncate(time.Second).Add(time.Second))):
+		}
+	}
 }
 
-func (block *Block) transactionsIsValid(chain *Blockchain, size uint64) bool {
+func (block *Block) validateTransactions(chain *Blockchain, size uint64, signatures bool) error {
 	lentxs := len(block.Transactions)
 	plusStorage := 0
 	for i := 0; i < lentxs; i++ {
@@ -90,45 +204,58 @@ func (block *Block) transactionsIsValid(chain *Blockchain, size uint64) bool {
 			break
 		}
 	}
-	if lentxs == 0 || lentxs > TXS_LIMIT+plusStorage {
-		return false
+	if lentxs == 0 {
+		return fmt.Errorf("%w: block has no transactions", ErrTxCount)
+	}
+	if Spec.TxsLimit != 0 && lentxs > Spec.TxsLimit+plusStorage {
+		return fmt.Errorf("%w: expected 1 to %d, got %d", ErrTxCount, Spec.TxsLimit+plusStorage, lentxs)
 	}
 	for i := 0; i < lentxs-1; i++ {
 		for j := i + 1; j < lentxs; j++ {
 			if bytes.Equal(block.Transactions[i].RandBytes, block.Transactions[j].RandBytes) {
-				return false
+				return fmt.Errorf("%w: tx %d and tx %d share random bytes", ErrDuplicateTx, i, j)
 			}
 			if 	block.Transactions[i].Sender == STORAGE_CHAIN && 
 				block.Transactions[j].Sender == STORAGE_CHAIN {
-					return false
+					return fmt.Errorf("%w: tx %d and tx %d are both rewards", ErrReward, i, j)
 			}
 		}
 	}
 	for i := 0; i < lentxs; i++ {
 		tx := block.Transactions[i]
 		if tx.Sender == STORAGE_CHAIN {
-			if tx.Receiver != block.Miner || tx.Value != STORAGE_REWARD {
-				return false
+			if tx.Receiver != block.RewardAddress() {
+				return fmt.Errorf("%w: tx %d: paid to %s instead of %s",
+					ErrReward, i, tx.Receiver, block.RewardAddress())
 			}
-		} else {
-			if !tx.hashIsValid() {
-				return false
+			if tx.Value != Spec.StorageReward {
+				return fmt.Errorf("%w: tx %d: expected %d, got %d", ErrReward, i, Spec.StorageReward, tx.Value)
+			}
+		} else if signatures {
+			err := tx.Validate()
+			if err != nil {
+				return fmt.Errorf("tx %d: %w", i, err)
 			}
-			if !tx.signIsValid() {
-				return false
+		} else {
+			err := tx.validateHash()
+			if err != nil {
+				return fmt.Errorf("tx %d: %w", i, err)
 			}
 		}
-		if !block.balanceIsValid(chain, tx.Sender, size) {
-			return false
+		err := block.validateBalance(chain, tx.Sender, size)
+		if err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
 		}
-		if !block.balanceIsValid(chain, tx.Receiver, size) {
-			return false
+		err = block.validateBalance(chain, tx.Receiver, size)
+		if err != nil {
+			return fmt.Errorf("tx %d: %w", i, err)
 		}
 	}
-	return true
+	return nil
 }
 
-func (block *Block) hash() []byte {
+// Hash computes the consensus hash of the block, CurrHash must equal it.
+func (block *Block) Hash() []byte {
 	var tempHash []byte
 	for _, tx := range block.Transactions {
 		tempHash = HashSum(bytes.Join(
@@ -154,29 +281,40 @@ func (block *Block) hash() []byte {
 			[]byte{},
 		))
 	}
-	return HashSum(bytes.Join(
-		[][]byte{
-			tempHash,
-			ToBytes(uint64(block.Difficulty)),
-			block.PrevHash,
-			[]byte(block.Miner),
-			[]byte(block.TimeStamp),
-		},
-		[]byte{},
-	))
+	fields := [][]byte{
+		tempHash,
+		ToBytes(uint64(block.Difficulty)),
+		block.PrevHash,
+		[]byte(block.Miner),
+		ToBytes(uint64(block.TimeStamp)),
+	}
+	if block.Coinbase != "" {
+		fields = append(fields, []byte(block.Coinbase))
+	}
+	if len(block.SpecHash) != 0 {
+		fields = append(fields, block.SpecHash)
+	}
+	return HashSum(bytes.Join(fields, []byte{}))
+}
+
+func (block *Block) RewardAddress() string {
+	if block.Coinbase != "" {
+		return block.Coinbase
+	}
+	return block.Miner
 }
 
 func (block *Block) sign(priv *rsa.PrivateKey) []byte {
 	return Sign(priv, block.CurrHash)
 }
 
-func (block *Block) proof(ch chan bool) uint64 {
-	return ProofOfWork(block.CurrHash, block.Difficulty, ch)
+func (block *Block) proof(ctx context.Context) (uint64, error) {
+	return ProofOfWork(ctx, block.CurrHash, block.Difficulty)
 }
 
-func (block *Block) balanceIsValid(chain *Blockchain, address string, size uint64) bool {
+func (block *Block) validateBalance(chain *Blockchain, address string, size uint64) error {
 	if _, ok := block.Mapping[address]; !ok {
-		return false
+		return fmt.Errorf("%w: address %s is missing from mapping", ErrBalance, address)
 	}
 	lentxs := len(block.Transactions)
 	balanceInChain := chain.Balance(address, size)
@@ -194,62 +332,89 @@ func (block *Block) balanceIsValid(chain *Blockchain, address string, size uint6
 			balanceAddBlock += tx.ToStorage
 		}
 	}
-	return (balanceInChain + balanceAddBlock - balanceSubBlock) == block.Mapping[address]
+	expected := balanceInChain + balanceAddBlock - balanceSubBlock
+	if expected != block.Mapping[address] {
+		return fmt.Errorf("%w: address %s: expected %d, got %d",
+			ErrBalance, address, expected, block.Mapping[address])
+	}
+	return nil
+}
+
+// validateSize checks the serialized size with room for what is
+// still to be filled in before the block is complete.
+func (block *Block) validateSize(reserve int) error {
+	if bsize := block.Size() + reserve; bsize > Spec.BlockSize {
+		return fmt.Errorf("%w: limit %d, got %d bytes", ErrBlockSize, Spec.BlockSize, bsize)
+	}
+	return nil
 }
 
 func (block *Block) IsValid(chain *Blockchain, size uint64) bool {
-	switch {
-	case block == nil:
-		return false
-	case block.Difficulty != DIFFICULTY:
-		return false
-	case !block.hashIsValid(chain, size):
-		return false
-	case !block.signIsValid():
-		return false
-	case !block.proofIsValid():
-		return false
-	case !block.mappingIsValid():
-		return false
-	case !block.timeIsValid(chain):
-		return false
-	case !block.transactionsIsValid(chain, size):
-		return false
-	}
-	return true
+	return block.Validate(chain, size) == nil
+}
+
+func (block *Block) Validate(chain *Blockchain, size uint64) error {
+	return block.validate(chain, size, true)
+}
+
+func (block *Block) ValidateAssumed(chain *Blockchain, size uint64) error {
+	return block.validate(chain, size, false)
 }
 
-func (block *Block) timeIsValid(chain *Blockchain) bool {
-	btime, err := time.Parse(time.RFC3339, block.TimeStamp)
+func (block *Block) validate(chain *Blockchain, size uint64, signatures bool) error {
+	if block == nil {
+		return ErrNilBlock
+	}
+	if block.Difficulty != Spec.Difficulty {
+		return fmt.Errorf("%w: expected %d, got %d", ErrDifficulty, Spec.Difficulty, block.Difficulty)
+	}
+	err := block.validateSize(0)
 	if err != nil {
-		return false
+		return err
 	}
-
-	different := time.Since(btime)
-	if different < 0 {
-		return false
+	err = block.validateHash(chain, size)
+	if err != nil {
+		return err
 	}
-
-	var sblock string
-	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Hash=$1", 
-		Base64Encode(block.PrevHash))
-	row.Scan(&sblock)
-
-	lblock := DeserializeBlock(sblock)
-	if lblock == nil {
-		return false
+	err = CheckCheckpoint(size, block.CurrHash)
+	if err != nil {
+		return err
 	}
-
-	ltime, err := time.Parse(time.RFC3339, lblock.TimeStamp)
+	if signatures {
+		err = block.validateSign()
+		if err != nil {
+			return err
+		}
+	}
+	err = block.validateProof()
+	if err != nil {
+		return err
+	}
+	err = block.validateMapping()
 	if err != nil {
-		return false
+		return err
 	}
+	err = block.validateTime(chain, size)
+	if err != nil {
+		return err
+	}
+	return block.validateTransactions(chain, size, signatures)
+}
 
-	result := btime.Sub(ltime)
-	return result > 0
+func (block *Block) validateTime(chain *Blockchain, size uint64) error {
+	limit := time.Now().Unix() + Spec.MaxFutureDrift
+	if block.TimeStamp > limit {
+		return fmt.Errorf("%w: %d is more than %d seconds in the future", ErrTimestamp,
+			block.TimeStamp, Spec.MaxFutureDrift)
+	}
+	median := chain.MedianTimePast(size)
+	if block.TimeStamp <= median {
+		return fmt.Errorf("%w: %d is not after median time past %d", ErrTimestamp, block.TimeStamp, median)
+	}
+	return nil
 }
 
-func (block *Block) mappingIsValid() bool {
+func (block *Block) validateMapping() error {
 	for addr := range block.Mapping {
 		if addr == STORAGE_CHAIN {
 			continue
@@ -262,39 +427,53 @@ func (block *Block) mappingIsValid() bool {
 			}
 		}
 		if !flag {
-			return false
+			return fmt.Errorf("%w: address %s is not used by any transaction", ErrMapping, addr)
 		}
 	}
-	return true
+	return nil
+}
+
+func (block *Block) ValidateWork() error {
+	if block == nil {
+		return ErrNilBlock
+	}
+	if block.Difficulty != Spec.Difficulty {
+		return fmt.Errorf("%w: expected %d, got %d", ErrDifficulty, Spec.Difficulty, block.Difficulty)
+	}
+	if hash := block.Hash(); !bytes.Equal(hash, block.CurrHash) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrBlockHash,
+			Base64Encode(hash), Base64Encode(block.CurrHash))
+	}
+	return block.validateProof()
 }
 
-func (block *Block) proofIsValid() bool {
-	intHash := big.NewInt(1)
-	Target := big.NewInt(1)
-	hash := HashSum(bytes.Join(
-		[][]byte{
-			block.CurrHash,
-			ToBytes(block.Nonce),
-		},
-		[]byte{},
-	))
-	intHash.SetBytes(hash)
-	Target.Lsh(Target, 256 - uint(block.Difficulty))
-	return intHash.Cmp(Target) == -1
+func (block *Block) validateProof() error {
+	return block.Header().validateProof()
 }
 
-func (block *Block) signIsValid() bool {
-	return Verify(ParsePublic(block.Miner), block.CurrHash, block.Signature) == nil
+func (block *Block) validateSign() error {
+	err := Verify(ParsePublic(block.Miner), block.CurrHash, block.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: miner %s", ErrBlockSignature, block.Miner)
+	}
+	return nil
 }
 
-func (block *Block) hashIsValid(chain *Blockchain, size uint64) bool {
-	if !bytes.Equal(block.hash(), block.CurrHash) {
-		return false
+func (block *Block) validateHash(chain *Blockchain, size uint64) error {
+	if hash := block.Hash(); !bytes.Equal(hash, block.CurrHash) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrBlockHash,
+			Base64Encode(hash), Base64Encode(block.CurrHash))
 	}
 	var id uint64
 	row := chain.DB.QueryRow("SELECT Id FROM BlockChain WHERE Hash=$1", Base64Encode(block.PrevHash))
 	row.Scan(&id)
-	return id == size
+	if id == 0 {
+		return fmt.Errorf("%w: parent %s not found", ErrPrevBlock, Base64Encode(block.PrevHash))
+	}
+	if id != size {
+		return fmt.Errorf("%w: parent is at height %d, chain height is %d", ErrPrevBlock, id-1, size)
+	}
+	return nil
 }
 
 func (block *Block) addBalance(chain *Blockchain, receiver string, value uint64) {
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestChain(t *testing.T, stamp int64) *Blockchain {
+	t.Helper()
+	genesis := DefaultGenesis(NewUser().Address())
+	genesis.TimeStamp = stamp
+	filename := filepath.Join(t.TempDir(), "chain.db")
+	err := NewChain(filename, genesis)
+	if err != nil {
+		t.Fatalf("cannot create chain: %v", err)
+	}
+	chain := LoadChain(filename)
+	if chain == nil {
+		t.Fatal("cannot load chain")
+	}
+	t.Cleanup(func() {
+		chain.DB.Close()
+	})
+	return chain
+}
+
+func TestValidateSize(t *testing.T) {
+	saved := Spec.BlockSize
+	defer func() {
+		Spec.BlockSize = saved
+	}()
+	block := NewBlock(NewUser().Address(), []byte("parent"))
+	size := block.Size()
+	tests := []struct {
+		name  string
+		limit int
+		err   error
+	}{
+		{"under the limit", size + 1, nil},
+		{"at the limit", size, nil},
+		{"one byte over", size - 1, ErrBlockSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Spec.BlockSize = test.limit
+			err := block.validateSize(0)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("limit %d, size %d: got %v, want %v", test.limit, size, err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidateTime(t *testing.T) {
+	median := time.Now().Unix() - 60
+	chain := newTestChain(t, median)
+	drift := Spec.MaxFutureDrift
+	tests := []struct {
+		name  string
+		stamp func() int64
+		err   error
+	}{
+		{"before median time past", func() int64 { return median - 1 }, ErrTimestamp},
+		{"at median time past", func() int64 { return median }, ErrTimestamp},
+		{"after median time past", func() int64 { return median + 1 }, nil},
+		{"now", func() int64 { return time.Now().Unix() }, nil},
+		{"at max future drift", func() int64 { return time.Now().Unix() + drift }, nil},
+		{"past max future drift", func() int64 { return time.Now().Unix() + drift + 1 }, ErrTimestamp},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := &Block{}
+			var err error
+			// retry if the clock ticks between the stamp and the check
+			for {
+				now := time.Now().Unix()
+				block.TimeStamp = test.stamp()
+				err = block.validateTime(chain, chain.Size())
+				if time.Now().Unix() == now {
+					break
+				}
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("stamp %d: got %v, want %v", block.TimeStamp, err, test.err)
+			}
+		})
+	}
+}
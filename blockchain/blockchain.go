@@ -2,9 +2,10 @@ package blockchain
 
 import (
 	"database/sql"
+	"encoding/json"
 	_ "github.com/mattn/go-sqlite3"
 	"os"
-	"time"
+	"sort"
 )
 
 type Blockchain struct {
@@ -12,7 +13,7 @@ type Blockchain struct {
 	index uint64
 }
 
-func NewChain(filename, receiver string) error {
+func NewChain(filename string, genesis *Genesis) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
@@ -28,42 +29,145 @@ func NewChain(filename, receiver string) error {
 	if err != nil {
 		return err
 	}
+	_, err = db.Exec(CREATE_INDEX)
+	if err != nil {
+		return err
+	}
 	chain := &Blockchain{
 		DB: db,
 	}
 
-	genesis := &Block{
-		PrevHash:  []byte(GENESIS_BLOCK),
-		Mapping:   make(map[string]uint64),
-		Miner:     receiver,
-		TimeStamp: time.Now().Format(time.RFC3339),
-	}
-	genesis.Mapping[STORAGE_CHAIN] = STORAGE_VALUE
-	genesis.Mapping[receiver] = GENESIS_REWARD
-	genesis.CurrHash = genesis.hash()
-	chain.AddBlock(genesis)
+	chain.AddBlock(genesis.Block())
 	return nil
 }
 
 func (chain *Blockchain) AddBlock(block *Block) {
 	chain.index += 1
-	chain.DB.Exec("INSERT INTO Blockchain (Hash, Block) VALUES ($1, $2)",
+	result, err := chain.DB.Exec("INSERT INTO Blockchain (Hash, Block) VALUES ($1, $2)",
 		Base64Encode(block.CurrHash),
 		SerializeBlock(block),
 	)
+	if err != nil {
+		logger.Error("cannot store block", "hash", Base64Encode(block.CurrHash), "err", err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("cannot store block", "hash", Base64Encode(block.CurrHash), "err", err)
+		return
+	}
+	chain.indexBlock(uint64(id), block)
+}
+
+func (chain *Blockchain) indexBlock(id uint64, block *Block) {
+	for i, tx := range block.Transactions {
+		var hash interface{}
+		if len(tx.CurrHash) != 0 {
+			hash = Base64Encode(tx.CurrHash)
+		}
+		_, err := chain.DB.Exec("INSERT OR REPLACE INTO Transactions (BlockId, Position, Hash, Sender, Receiver) VALUES ($1, $2, $3, $4, $5)",
+			id,
+			i,
+			hash,
+			tx.Sender,
+			tx.Receiver,
+		)
+		if err != nil {
+			logger.Error("cannot index transaction", "block", id, "position", i, "err", err)
+		}
+	}
 }
 
 func LoadChain(filename string) *Blockchain {
 	db, err := sql.Open("sqlite3", filename)
 	if err != nil {
+		logger.Error("cannot open chain", "file", filename, "err", err)
 		return nil
 	}
 	chain := &Blockchain{
 		DB: db,
 	}
+	_, err = db.Exec(CREATE_INDEX)
+	if err != nil {
+		logger.Error("cannot create index", "file", filename, "err", err)
+		db.Close()
+		return nil
+	}
+	genesis := chain.Block(0)
+	if genesis == nil && chain.Size() != 0 && chain.hasTextTimeStamps() {
+		logger.Error("cannot load chain", "file", filename, "err",
+			"database format changed, block timestamps are Unix seconds and hashed as such, "+
+				"older databases cannot be converted, recreate the chain database and sync it again")
+		db.Close()
+		return nil
+	}
+	if genesis == nil && chain.Size() != 0 {
+		logger.Error("cannot load chain", "file", filename, "err", "genesis block cannot be decoded")
+		db.Close()
+		return nil
+	}
+	if genesis != nil {
+		err = genesis.ValidateGenesis()
+		if err != nil {
+			logger.Error("cannot load chain", "file", filename, "err", err)
+			db.Close()
+			return nil
+		}
+	}
+	chain.reindex()
 	return chain
 }
 
+// Databases before Unix timestamps stored RFC3339 strings, which are
+// part of the block hash and so cannot be rewritten in place.
+func (chain *Blockchain) hasTextTimeStamps() bool {
+	var (
+		sblock string
+		block  struct {
+			TimeStamp json.RawMessage
+		}
+	)
+	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Id=1")
+	row.Scan(&sblock)
+	err := json.Unmarshal([]byte(sblock), &block)
+	return err == nil && len(block.TimeStamp) != 0 && block.TimeStamp[0] == '"'
+}
+
+func (chain *Blockchain) reindex() {
+	var (
+		indexed uint64
+		id      uint64
+		sblock  string
+	)
+	row := chain.DB.QueryRow("SELECT IFNULL(MAX(BlockId), 0) FROM Transactions")
+	row.Scan(&indexed)
+	rows, err := chain.DB.Query("SELECT Id, Block FROM BlockChain WHERE Id > $1 ORDER BY Id ASC", indexed)
+	if err != nil {
+		logger.Error("cannot reindex chain", "err", err)
+		return
+	}
+	var (
+		ids    []uint64
+		blocks []*Block
+	)
+	for rows.Next() {
+		rows.Scan(&id, &sblock)
+		block := DeserializeBlock(sblock)
+		if block == nil {
+			continue
+		}
+		ids = append(ids, id)
+		blocks = append(blocks, block)
+	}
+	rows.Close()
+	if len(blocks) != 0 {
+		logger.Debug("indexing transactions", "blocks", len(blocks))
+	}
+	for i, block := range blocks {
+		chain.indexBlock(ids[i], block)
+	}
+}
+
 func (chain *Blockchain) Size() uint64 {
 	var size uint64
 	row := chain.DB.QueryRow("SELECT Id FROM BlockChain ORDER BY Id DESC")
@@ -99,3 +203,175 @@ func (chain *Blockchain) Balance(address string, size uint64) uint64 {
 	}
 	return balance
 }
+
+func (chain *Blockchain) Headers(from, count uint64) []*Header {
+	var (
+		sblock  string
+		headers []*Header
+	)
+	rows, err := chain.DB.Query("SELECT Block FROM BlockChain WHERE Id > $1 ORDER BY Id ASC LIMIT $2", from, count)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rows.Scan(&sblock)
+		block := DeserializeBlock(sblock)
+		if block == nil {
+			return nil
+		}
+		headers = append(headers, block.Header())
+	}
+	return headers
+}
+
+func (chain *Blockchain) BlockByHash(hash []byte) *Block {
+	var sblock string
+	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Hash=$1", Base64Encode(hash))
+	err := row.Scan(&sblock)
+	if err != nil {
+		return nil
+	}
+	return DeserializeBlock(sblock)
+}
+
+func (chain *Blockchain) HasBlock(hash []byte) bool {
+	var id uint64
+	row := chain.DB.QueryRow("SELECT Id FROM BlockChain WHERE Hash=$1", Base64Encode(hash))
+	return row.Scan(&id) == nil
+}
+
+func (chain *Blockchain) Block(height uint64) *Block {
+	var sblock string
+	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Id=$1", height+1)
+	err := row.Scan(&sblock)
+	if err != nil {
+		return nil
+	}
+	return DeserializeBlock(sblock)
+}
+
+func (chain *Blockchain) Height(hash []byte) (uint64, bool) {
+	var id uint64
+	row := chain.DB.QueryRow("SELECT Id FROM BlockChain WHERE Hash=$1", Base64Encode(hash))
+	err := row.Scan(&id)
+	if err != nil {
+		return 0, false
+	}
+	return id - 1, true
+}
+
+func (chain *Blockchain) Transaction(hash []byte) (*Transaction, *Block, uint64) {
+	var (
+		id       uint64
+		position int
+	)
+	if len(hash) == 0 {
+		return nil, nil, 0
+	}
+	row := chain.DB.QueryRow("SELECT BlockId, Position FROM Transactions WHERE Hash=$1", Base64Encode(hash))
+	err := row.Scan(&id, &position)
+	if err != nil {
+		return nil, nil, 0
+	}
+	block := chain.Block(id - 1)
+	if block == nil || position >= len(block.Transactions) {
+		return nil, nil, 0
+	}
+	return &block.Transactions[position], block, id - 1
+}
+
+func (chain *Blockchain) MedianTimePast(size uint64) int64 {
+	var stamps []int64
+	from := uint64(0)
+	if size > uint64(Spec.MedianBlocks) {
+		from = size - uint64(Spec.MedianBlocks)
+	}
+	for i := from; i < size; i++ {
+		block := chain.Block(i)
+		if block == nil {
+			continue
+		}
+		stamps = append(stamps, block.TimeStamp)
+	}
+	if len(stamps) == 0 {
+		return 0
+	}
+	sort.Slice(stamps, func(i, j int) bool {
+		return stamps[i] < stamps[j]
+	})
+	return stamps[len(stamps)/2]
+}
+
+func (chain *Blockchain) Blocks(from, limit uint64) []*Block {
+	var (
+		sblock string
+		blocks []*Block
+	)
+	rows, err := chain.DB.Query("SELECT Block FROM BlockChain WHERE Id > $1 ORDER BY Id ASC LIMIT $2", from, limit)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rows.Scan(&sblock)
+		block := DeserializeBlock(sblock)
+		if block == nil {
+			return nil
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+type TxEntry struct {
+	Transaction *Transaction
+	BlockHash   []byte
+	Height      uint64
+	TimeStamp   int64
+}
+
+func (chain *Blockchain) AddressTransactions(address string, offset, limit uint64) []*TxEntry {
+	var (
+		id       uint64
+		position int
+		entries  []*TxEntry
+		blocks   = make(map[uint64]*Block)
+	)
+	rows, err := chain.DB.Query(`
+		SELECT BlockId, Position FROM Transactions WHERE Sender=$1
+		UNION
+		SELECT BlockId, Position FROM Transactions WHERE Receiver=$1
+		ORDER BY BlockId DESC, Position DESC LIMIT $2 OFFSET $3`,
+		address, limit, offset)
+	if err != nil {
+		return nil
+	}
+	type location struct {
+		id       uint64
+		position int
+	}
+	var locations []location
+	for rows.Next() {
+		rows.Scan(&id, &position)
+		locations = append(locations, location{id, position})
+	}
+	rows.Close()
+	for _, loc := range locations {
+		block, ok := blocks[loc.id]
+		if !ok {
+			block = chain.Block(loc.id - 1)
+			blocks[loc.id] = block
+		}
+		if block == nil || loc.position >= len(block.Transactions) {
+			continue
+		}
+		entries = append(entries, &TxEntry{
+			Transaction: &block.Transactions[loc.position],
+			BlockHash:   block.CurrHash,
+			Height:      loc.id - 1,
+			TimeStamp:   block.TimeStamp,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	CHECKPOINT_SEPARATOR = ":"
+)
+
+type Checkpoints map[uint64][]byte
+
+var checkpoints = make(Checkpoints)
+
+func ParseCheckpoints(list []string) (Checkpoints, error) {
+	result := make(Checkpoints)
+	for _, item := range list {
+		parts := strings.SplitN(item, CHECKPOINT_SEPARATOR, 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("checkpoint %q is not height%shash", item, CHECKPOINT_SEPARATOR)
+		}
+		height, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: height is not a number", item)
+		}
+		hash := Base64Decode(parts[1])
+		if len(hash) != HASH_SIZE {
+			return nil, fmt.Errorf("checkpoint %q: hash is not a base64 %d byte hash", item, HASH_SIZE)
+		}
+		if prev, ok := result[height]; ok && !bytes.Equal(prev, hash) {
+			return nil, fmt.Errorf("checkpoint %q conflicts with another checkpoint at height %d", item, height)
+		}
+		result[height] = hash
+	}
+	return result, nil
+}
+
+func SetCheckpoints(list Checkpoints) {
+	checkpoints = list
+}
+
+func CheckCheckpoint(height uint64, hash []byte) error {
+	expected, ok := checkpoints[height]
+	if !ok || bytes.Equal(expected, hash) {
+		return nil
+	}
+	return fmt.Errorf("%w: height %d must be %s, got %s", ErrCheckpoint,
+		height, Base64Encode(expected), Base64Encode(hash))
+}
+
+// CheckCheckpoints checks the checkpoints against the stored chain,
+// which may predate them.
+func (chain *Blockchain) CheckCheckpoints() error {
+	size := chain.Size()
+	for height := range checkpoints {
+		if height >= size {
+			continue
+		}
+		block := chain.Block(height)
+		if block == nil {
+			return fmt.Errorf("%w: height %d cannot be read", ErrCheckpoint, height)
+		}
+		err := CheckCheckpoint(height, block.CurrHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
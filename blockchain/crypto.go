@@ -9,10 +9,6 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
-	"fmt"
-	"math"
-	"math/big"
-	mrand "math/rand"
 )
 
 func GenerateRandomBytes(max uint) []byte {
@@ -93,42 +89,3 @@ func Base64Decode(data string) []byte {
 	}
 	return result
 }
-
-func ProofOfWork(blockHash []byte, diff uint8, ch chan bool) uint64 {
-	var (
-		Target = big.NewInt(1)
-		intHash = big.NewInt(1)
-		nonce = uint64(mrand.Intn(math.MaxUint32))
-		hash []byte
-	)
-	Target.Lsh(Target, 256 - uint(diff))
-	for nonce < math.MaxUint64 {
-		select {
-		case <-ch:
-			if DEBUG {
-				fmt.Println()
-			}
-			return nonce
-		default:
-			hash = HashSum(bytes.Join(
-				[][]byte{
-					blockHash,
-					ToBytes(nonce),
-				},
-				[]byte{},
-			))
-			if DEBUG {
-				fmt.Printf("\rMining: %s", Base64Encode(hash))
-			}
-			intHash.SetBytes(hash)
-			if intHash.Cmp(Target) == -1 {
-				if DEBUG {
-					fmt.Println()
-				}
-				return nonce
-			}
-		}
-		nonce++
-	}
-	return nonce
-}
\ No newline at end of file
@@ -0,0 +1,31 @@
+package blockchain
+
+import "errors"
+
+var (
+	ErrNilBlock          = errors.New("block is nil")
+	ErrDifficulty        = errors.New("difficulty mismatch")
+	ErrBlockHash         = errors.New("block hash is not valid")
+	ErrPrevBlock         = errors.New("previous block is not the chain tip")
+	ErrBlockSignature    = errors.New("block signature is not valid")
+	ErrProof             = errors.New("proof of work is not valid")
+	ErrMapping           = errors.New("mapping is not valid")
+	ErrTimestamp         = errors.New("timestamp is not valid")
+	ErrTxCount           = errors.New("transaction count is not valid")
+	ErrDuplicateTx       = errors.New("duplicate transaction")
+	ErrReward            = errors.New("storage reward is not valid")
+	ErrBalance           = errors.New("balance is not valid")
+	ErrHeaderLink        = errors.New("header does not link to previous header")
+	ErrNilTx             = errors.New("transaction is nil")
+	ErrTxHash            = errors.New("transaction hash is not valid")
+	ErrTxSignature       = errors.New("transaction signature is not valid")
+	ErrTxValue           = errors.New("transaction value is zero")
+	ErrTxLimit           = errors.New("block transaction limit reached")
+	ErrBlockSize         = errors.New("block size limit exceeded")
+	ErrTxStorage         = errors.New("transaction storage fee is not valid")
+	ErrTxPrevBlock       = errors.New("transaction is not based on the chain tip")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNonceExhausted    = errors.New("nonce space exhausted")
+	ErrChainSpec         = errors.New("chain spec mismatch")
+	ErrCheckpoint        = errors.New("block conflicts with a checkpoint")
+)
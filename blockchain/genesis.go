@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+type Genesis struct {
+	TimeStamp   int64             `json:"timeStamp"`
+	Allocations map[string]uint64 `json:"allocations"`
+	Spec        *ChainSpec        `json:"spec"`
+}
+
+func DefaultGenesis(receiver string) *Genesis {
+	return &Genesis{
+		TimeStamp: time.Now().Unix(),
+		Allocations: map[string]uint64{
+			receiver: Spec.GenesisReward,
+		},
+		Spec: Spec,
+	}
+}
+
+func LoadGenesis(filename string) (*Genesis, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	genesis := &Genesis{
+		Spec: DefaultSpec(),
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(genesis)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", filename, err)
+	}
+	err = genesis.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return genesis, nil
+}
+
+func (genesis *Genesis) Validate() error {
+	if genesis.TimeStamp <= 0 {
+		return fmt.Errorf("timeStamp must be positive Unix seconds, got %d", genesis.TimeStamp)
+	}
+	if len(genesis.Allocations) == 0 {
+		return errors.New("at least one allocation is required")
+	}
+	for addr, value := range genesis.Allocations {
+		if addr == STORAGE_CHAIN {
+			return fmt.Errorf("allocation to %s is not allowed, use the spec storageValue", STORAGE_CHAIN)
+		}
+		if ParsePublic(addr) == nil {
+			return fmt.Errorf("allocation address %q is not valid", addr)
+		}
+		if value == 0 {
+			return fmt.Errorf("allocation to %s is zero", addr)
+		}
+	}
+	if genesis.Spec == nil {
+		return errors.New("spec is required")
+	}
+	err := genesis.Spec.Validate()
+	if err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	return nil
+}
+
+func (genesis *Genesis) Block() *Block {
+	block := &Block{
+		PrevHash:  []byte(GENESIS_BLOCK),
+		Mapping:   make(map[string]uint64),
+		TimeStamp: genesis.TimeStamp,
+		SpecHash:  genesis.Spec.Hash(),
+	}
+	for addr, value := range genesis.Allocations {
+		block.Mapping[addr] = value
+	}
+	block.Mapping[STORAGE_CHAIN] = genesis.Spec.StorageValue
+	block.CurrHash = block.Hash()
+	return block
+}
@@ -0,0 +1,68 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+type Header struct {
+	CurrHash   []byte
+	PrevHash   []byte
+	Nonce      uint64
+	Difficulty uint8
+	Miner      string
+	Signature  []byte
+	TimeStamp  int64
+}
+
+func (block *Block) Header() *Header {
+	return &Header{
+		CurrHash:   block.CurrHash,
+		PrevHash:   block.PrevHash,
+		Nonce:      block.Nonce,
+		Difficulty: block.Difficulty,
+		Miner:      block.Miner,
+		Signature:  block.Signature,
+		TimeStamp:  block.TimeStamp,
+	}
+}
+
+func (header *Header) IsGenesis() bool {
+	return bytes.Equal(header.PrevHash, []byte(GENESIS_BLOCK))
+}
+
+func (header *Header) IsValid(prev *Header) bool {
+	return header.Validate(prev) == nil
+}
+
+func (header *Header) Validate(prev *Header) error {
+	switch {
+	case header == nil || prev == nil:
+		return ErrNilBlock
+	case !bytes.Equal(header.PrevHash, prev.CurrHash):
+		return fmt.Errorf("%w: expected parent %s, got %s", ErrHeaderLink,
+			Base64Encode(prev.CurrHash), Base64Encode(header.PrevHash))
+	case header.Difficulty != Spec.Difficulty:
+		return fmt.Errorf("%w: expected %d, got %d", ErrDifficulty, Spec.Difficulty, header.Difficulty)
+	}
+	return header.validateProof()
+}
+
+func (header *Header) validateProof() error {
+	intHash := big.NewInt(1)
+	Target := big.NewInt(1)
+	hash := HashSum(bytes.Join(
+		[][]byte{
+			header.CurrHash,
+			ToBytes(header.Nonce),
+		},
+		[]byte{},
+	))
+	intHash.SetBytes(hash)
+	Target.Lsh(Target, 256-uint(header.Difficulty))
+	if intHash.Cmp(Target) != -1 {
+		return fmt.Errorf("%w: nonce %d does not meet difficulty %d", ErrProof, header.Nonce, header.Difficulty)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package blockchain
+
+const (
+	DIRECTION_IN   = "in"
+	DIRECTION_OUT  = "out"
+	DIRECTION_SELF = "self"
+)
+
+type HistoryEntry struct {
+	Hash         []byte
+	Direction    string
+	Counterparty string
+	Amount       uint64
+	Fee          uint64
+	Height       uint64
+	TimeStamp    int64
+}
+
+func (chain *Blockchain) History(address string, offset, limit uint64) []*HistoryEntry {
+	var history []*HistoryEntry
+	for _, entry := range chain.AddressTransactions(address, offset, limit) {
+		tx := entry.Transaction
+		item := &HistoryEntry{
+			Hash:      tx.CurrHash,
+			Amount:    tx.Value,
+			Fee:       tx.ToStorage,
+			Height:    entry.Height,
+			TimeStamp: entry.TimeStamp,
+		}
+		switch {
+		case tx.Sender == address && tx.Receiver == address:
+			item.Direction = DIRECTION_SELF
+			item.Counterparty = address
+		case tx.Sender == address:
+			item.Direction = DIRECTION_OUT
+			item.Counterparty = tx.Receiver
+		default:
+			item.Direction = DIRECTION_IN
+			item.Counterparty = tx.Sender
+		}
+		history = append(history, item)
+	}
+	return history
+}
@@ -0,0 +1,9 @@
+package blockchain
+
+import "log/slog"
+
+var logger = slog.Default().With("component", "blockchain")
+
+func SetLogger(base *slog.Logger) {
+	logger = base.With("component", "blockchain")
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"math/big"
+	mrand "math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MINING_BATCH  = (1 << 12)
+	HASHRATE_TIME = 1
+)
+
+func ProofOfWork(ctx context.Context, blockHash []byte, diff uint8) (uint64, error) {
+	var (
+		Target  = big.NewInt(1)
+		workers = uint64(runtime.GOMAXPROCS(0))
+		start   = mrand.Uint64()
+		step    = math.MaxUint64 / workers
+		found   = make(chan uint64, workers)
+		done    = make(chan bool)
+		tried   = uint64(0)
+		began   = time.Now()
+		wg      sync.WaitGroup
+	)
+	Target.Lsh(Target, 256-uint(diff))
+	search, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i := uint64(0); i < workers; i++ {
+		count := step
+		if i == workers-1 {
+			count = math.MaxUint64 - step*(workers-1)
+		}
+		wg.Add(1)
+		go func(from, count uint64) {
+			defer wg.Done()
+			nonce, ok := searchNonce(search, blockHash, Target, from, count, &tried)
+			if ok {
+				found <- nonce
+			}
+		}(start+i*step, count)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(HASHRATE_TIME * time.Second)
+	defer ticker.Stop()
+	var (
+		lastTime  = began
+		lastTried = uint64(0)
+	)
+	for {
+		select {
+		case nonce := <-found:
+			cancel()
+			<-done
+			recordWork(began, atomic.LoadUint64(&tried))
+			logger.Debug("proof of work found", "nonce", nonce,
+				"tried", atomic.LoadUint64(&tried), "workers", workers)
+			return nonce, nil
+		case <-done:
+			recordWork(began, atomic.LoadUint64(&tried))
+			select {
+			case nonce := <-found:
+				return nonce, nil
+			default:
+			}
+			if ctx.Err() != nil {
+				logger.Debug("proof of work cancelled", "tried", atomic.LoadUint64(&tried))
+				return 0, ctx.Err()
+			}
+			return 0, ErrNonceExhausted
+		case now := <-ticker.C:
+			current := atomic.LoadUint64(&tried)
+			setHashRate(float64(current-lastTried) / now.Sub(lastTime).Seconds())
+			lastTime, lastTried = now, current
+		}
+	}
+}
+
+func searchNonce(ctx context.Context, blockHash []byte, target *big.Int, from, count uint64, tried *uint64) (uint64, bool) {
+	var (
+		intHash = big.NewInt(1)
+		nonce   = from
+		batch   = uint64(0)
+	)
+	defer func() {
+		countWork(tried, batch)
+	}()
+	for i := uint64(0); i < count; i++ {
+		if batch == MINING_BATCH {
+			countWork(tried, batch)
+			batch = 0
+			select {
+			case <-ctx.Done():
+				return 0, false
+			default:
+			}
+		}
+		hash := HashSum(bytes.Join(
+			[][]byte{
+				blockHash,
+				ToBytes(nonce),
+			},
+			[]byte{},
+		))
+		batch++
+		intHash.SetBytes(hash)
+		if intHash.Cmp(target) == -1 {
+			return nonce, true
+		}
+		nonce++
+	}
+	return 0, false
+}
@@ -14,22 +14,34 @@ const (
 			Block TEXT
 		)
 	`
+	CREATE_INDEX = `
+		CREATE TABLE IF NOT EXISTS Transactions (
+			BlockId INTEGER,
+			Position INTEGER,
+			Hash VARCHAR(44),
+			Sender TEXT,
+			Receiver TEXT,
+			PRIMARY KEY (BlockId, Position)
+		);
+		CREATE INDEX IF NOT EXISTS TransactionsTxHash ON Transactions (Hash) WHERE Hash IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS TransactionsSender ON Transactions (Sender, BlockId);
+		CREATE INDEX IF NOT EXISTS TransactionsReceiver ON Transactions (Receiver, BlockId);
+	`
 )
 
 const (
-	KEY_SIZE = 512 //very small, only test
-	DEBUG = true
-	TXS_LIMIT = 2
-	DIFFICULTY = 20
 	RAND_BYTES = 32
-	START_PERCENT = 10
-	STORAGE_REWARD = 1
+	HASH_SIZE = 32
+	BLOCK_RESERVE = (1 << 10)
+	MAX_BLOCK_SIZE = (1 << 20)
+	MAX_KEY_SIZE = (8 << 10)
+	KEY_OVERHEAD = 64
+	ENTRY_OVERHEAD = 8
+	NONCE_DIGITS = 20
 )
 
 const (
 	GENESIS_BLOCK = "GENESIS-BLOCK"
-	STORAGE_VALUE = 100
-	GENESIS_REWARD = 100
 	STORAGE_CHAIN = "STORAGE-CHAIN"
 )
 
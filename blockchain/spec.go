@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+type ChainSpec struct {
+	Name           string `json:"name"`
+	KeySize        uint   `json:"keySize"`
+	BlockSize      int    `json:"blockSize"`
+	TxsLimit       int    `json:"txsLimit"`
+	Difficulty     uint8  `json:"difficulty"`
+	StartPercent   uint64 `json:"startPercent"`
+	StorageReward  uint64 `json:"storageReward"`
+	StorageValue   uint64 `json:"storageValue"`
+	GenesisReward  uint64 `json:"genesisReward"`
+	MedianBlocks   int    `json:"medianBlocks"`
+	MaxFutureDrift int64  `json:"maxFutureDrift"`
+}
+
+var Spec = DefaultSpec()
+
+func DefaultSpec() *ChainSpec {
+	return &ChainSpec{
+		Name:           "devnet",
+		KeySize:        512, // very small, only test
+		BlockSize:      (64 << 10),
+		TxsLimit:       0,
+		Difficulty:     20,
+		StartPercent:   10,
+		StorageReward:  1,
+		StorageValue:   100,
+		GenesisReward:  100,
+		MedianBlocks:   11,
+		MaxFutureDrift: 2 * 60,
+	}
+}
+
+func LoadSpec(filename string) (*ChainSpec, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	spec := DefaultSpec()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", filename, err)
+	}
+	err = spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func SetSpec(spec *ChainSpec) {
+	Spec = spec
+}
+
+func (spec *ChainSpec) Validate() error {
+	switch {
+	case spec.Name == "":
+		return errors.New("name is required")
+	case spec.KeySize < 512 || spec.KeySize > MAX_KEY_SIZE || spec.KeySize%64 != 0:
+		return fmt.Errorf("keySize must be a multiple of 64 between 512 and %d, got %d", MAX_KEY_SIZE, spec.KeySize)
+	case spec.BlockSize < spec.minBlockSize() || spec.BlockSize > MAX_BLOCK_SIZE:
+		return fmt.Errorf("blockSize must be between %d and %d bytes for keySize %d, got %d",
+			spec.minBlockSize(), MAX_BLOCK_SIZE, spec.KeySize, spec.BlockSize)
+	case spec.TxsLimit < 0:
+		return fmt.Errorf("txsLimit must not be negative, got %d", spec.TxsLimit)
+	case spec.Difficulty == 0:
+		return errors.New("difficulty must be positive")
+	case spec.StorageReward == 0:
+		return errors.New("storageReward must be positive")
+	case spec.MedianBlocks < 1:
+		return fmt.Errorf("medianBlocks must be positive, got %d", spec.MedianBlocks)
+	case spec.MaxFutureDrift < 0:
+		return fmt.Errorf("maxFutureDrift must not be negative, got %d", spec.MaxFutureDrift)
+	}
+	return nil
+}
+
+// Reserve is the room kept for the reward transaction, its receiver
+// in the mapping and the block signature, which all grow with the key.
+func (spec *ChainSpec) Reserve() int {
+	return BLOCK_RESERVE + 3*base64.StdEncoding.EncodedLen(int(spec.KeySize/8)+KEY_OVERHEAD)
+}
+
+func (spec *ChainSpec) minBlockSize() int {
+	if size := 2 * spec.Reserve(); size > 4*BLOCK_RESERVE {
+		return size
+	}
+	return 4 * BLOCK_RESERVE
+}
+
+func (spec *ChainSpec) Hash() []byte {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil
+	}
+	return HashSum(data)
+}
+
+func (block *Block) ValidateGenesis() error {
+	if block == nil {
+		return ErrNilBlock
+	}
+	if !bytes.Equal(block.PrevHash, []byte(GENESIS_BLOCK)) {
+		return fmt.Errorf("%w: block is not a genesis block", ErrChainSpec)
+	}
+	if !bytes.Equal(block.CurrHash, block.Hash()) {
+		return fmt.Errorf("%w: %s", ErrBlockHash, Base64Encode(block.CurrHash))
+	}
+	expected := Spec.Hash()
+	if len(block.SpecHash) == 0 {
+		return fmt.Errorf("%w: genesis predates chain specs, running %s", ErrChainSpec, Spec.Name)
+	}
+	if !bytes.Equal(block.SpecHash, expected) {
+		return fmt.Errorf("%w: genesis was created for spec %s, running %s (%s)", ErrChainSpec,
+			Base64Encode(block.SpecHash), Base64Encode(expected), Spec.Name)
+	}
+	return nil
+}
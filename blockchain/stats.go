@@ -0,0 +1,37 @@
+package blockchain
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	noncesTried uint64
+	hashRate    uint64
+)
+
+func NoncesTried() uint64 {
+	return atomic.LoadUint64(&noncesTried)
+}
+
+func HashRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&hashRate))
+}
+
+func setHashRate(rate float64) {
+	atomic.StoreUint64(&hashRate, math.Float64bits(rate))
+}
+
+func countWork(tried *uint64, count uint64) {
+	atomic.AddUint64(tried, count)
+	atomic.AddUint64(&noncesTried, count)
+}
+
+func recordWork(start time.Time, tried uint64) {
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	setHashRate(float64(tried) / elapsed)
+}
@@ -3,6 +3,7 @@ package blockchain
 import (
 	"bytes"
 	"crypto/rsa"
+	"fmt"
 )
 
 type Transaction struct {
@@ -24,8 +25,8 @@ func NewTransaction(user *User, lastHash []byte, to string, value uint64) *Trans
 		Receiver: to,
 		Value: value,
 	}
-	if value > START_PERCENT {
-		tx.ToStorage = STORAGE_REWARD
+	if value > Spec.StartPercent {
+		tx.ToStorage = Spec.StorageReward
 	}
 	tx.CurrHash = tx.hash()
 	tx.Signature = tx.sign(user.Private())
@@ -50,10 +51,33 @@ func (tx *Transaction) sign(priv *rsa.PrivateKey) []byte {
 	return Sign(priv, tx.CurrHash)
 }
 
-func (tx *Transaction) hashIsValid() bool {
-	return bytes.Equal(tx.hash(), tx.CurrHash)
+func (tx *Transaction) validateHash() error {
+	if hash := tx.hash(); !bytes.Equal(hash, tx.CurrHash) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrTxHash,
+			Base64Encode(hash), Base64Encode(tx.CurrHash))
+	}
+	return nil
+}
+
+func (tx *Transaction) validateSign() error {
+	err := Verify(ParsePublic(tx.Sender), tx.CurrHash, tx.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: sender %s", ErrTxSignature, tx.Sender)
+	}
+	return nil
 }
 
-func (tx *Transaction) signIsValid() bool {
-	return Verify(ParsePublic(tx.Sender), tx.CurrHash, tx.Signature) == nil
+func (tx *Transaction) IsValid() bool {
+	return tx.Validate() == nil
+}
+
+func (tx *Transaction) Validate() error {
+	if tx == nil {
+		return ErrNilTx
+	}
+	err := tx.validateHash()
+	if err != nil {
+		return err
+	}
+	return tx.validateSign()
 }
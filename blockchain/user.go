@@ -8,7 +8,7 @@ type User struct {
 
 func NewUser() *User {
 	return &User{
-		PrivateKey: GeneratePrivate(KEY_SIZE),
+		PrivateKey: GeneratePrivate(Spec.KeySize),
 	}
 }
 
@@ -34,4 +34,21 @@ func DeserializeTX(data string) *Transaction {
 		return nil
 	}
 	return &tx
-}
\ No newline at end of file
+}
+
+func SerializeHeaders(headers []*Header) string {
+	jsonData, err := json.Marshal(headers)
+	if err != nil {
+		return ""
+	}
+	return string(jsonData)
+}
+
+func DeserializeHeaders(data string) []*Header {
+	var headers []*Header
+	err := json.Unmarshal([]byte(data), &headers)
+	if err != nil {
+		return nil
+	}
+	return headers
+}
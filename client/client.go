@@ -1,15 +1,18 @@
 package main
 
-// ./client -loaduser:node1.key -loadaddr:addr.json
+// ./client -key node1.key -addrfile addr.json
+// CLIENT_NODES=:8080,:9090 CLIENT_KEY=node1.key ./client
 
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
 	nt "github.com/MIHAIL33/CryptoCoin/network"
@@ -22,8 +25,34 @@ const (
 	GET_LHASH
 	GET_BLNCE
 	GET_CSIZE
+	GET_PEERS
+	GET_HDRS
+	ADD_INVNT
+	GET_DATA
+	GET_BANS
+	DEL_BANS
+	GET_TRNSX
+	GET_HISTR
 )
 
+const (
+	SEPARATOR    = "_SEPARATOR_"
+	HISTORY_PAGE = 10
+)
+
+const (
+	TX_POLL_TIME  = 5
+	TX_POLL_LIMIT = 120
+)
+
+type TransactionInfo struct {
+	Transaction   *bc.Transaction `json:"transaction"`
+	Status        string          `json:"status"`
+	BlockHash     string          `json:"blockHash,omitempty"`
+	Height        uint64          `json:"height,omitempty"`
+	Confirmations uint64          `json:"confirmations,omitempty"`
+}
+
 var (
 	Addresses []string
 	User *bc.User
@@ -34,58 +63,25 @@ func main() {
 }
 
 func init() {
-	if len(os.Args) < 2 {
-		panic("failed 1")
-	}
-
-	var (
-		addrStr = ""
-		userNewStr = ""
-		userLoadStr = ""
-	)
-
-	var (
-		addrExist = false
-		userNewExist = false
-		userLoadExist = false
-	)
-
-	for i := 1; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch {
-		case strings.HasPrefix(arg, "-loadaddr:"):
-			addrStr = strings.Replace(arg, "-loadaddr:", "", 1)
-			addrExist = true
-		case strings.HasPrefix(arg, "-newuser:"):
-			userNewStr = strings.Replace(arg, "-newuser:", "", 1)
-			userNewExist = true
-		case strings.HasPrefix(arg, "-loaduser:"):
-			userLoadStr = strings.Replace(arg, "-loaduser:", "", 1)
-			userLoadExist = true
-		}
-	}
-
-	if !(userNewExist || userLoadExist) || !addrExist {
-		panic("failed 2")
-	}
-	err := json.Unmarshal([]byte(readFile(addrStr)), &Addresses)
+	config, err := loadConfig(os.Args[1:])
 	if err != nil {
-		panic("failed 3")
-	}
-	if len(Addresses) == 0 {
-		panic("failed 4")
-	}
-
-	if userNewExist {
-		User = userNew(userNewStr)
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
 	}
-	if userLoadExist{
-		User = userLoad(userLoadStr)
+	Addresses = config.Nodes
+	bc.SetSpec(config.chainSpec)
+	if fileExists(config.Key) {
+		User = userLoad(config.Key)
+	} else {
+		User = userNew(config.Key)
 	}
 	if User == nil {
-		panic("failed 5")
+		fmt.Fprintf(os.Stderr, "cannot load or create key file %s\n", config.Key)
+		os.Exit(1)
 	}
-} 
+}
 
 func readFile(filename string) string {
 	data, err := ioutil.ReadFile(filename)
@@ -146,6 +142,8 @@ func handleClient() {
 				userPurse()
 			case "balance":
 				userBalance()
+			case "history":
+				userHistory(splited[1:])
 			default:
     			fmt.Println("command undefined")
 			}
@@ -168,6 +166,30 @@ func handleClient() {
 			default:
     			fmt.Println("command undefined")
 			}
+		case "/tx":
+			if len(splited) < 2 {
+				fmt.Println("failed: len(tx) < 2")
+				continue
+			}
+			switch splited[1] {
+			case "status":
+				txStatus(splited[1:])
+			default:
+				fmt.Println("command undefined")
+			}
+		case "/admin":
+			if len(splited) < 2 {
+				fmt.Println("failed: len(admin) < 2")
+				continue
+			}
+			switch splited[1] {
+			case "bans":
+				adminBans()
+			case "unban":
+				adminUnban(splited[1:])
+			default:
+				fmt.Println("command undefined")
+			}
 		default:
 			fmt.Println("command undefined")
 		}
@@ -194,7 +216,7 @@ func userBalance() {
 
 func chainPrint() {
 	for i := 0; ; i++ {
-		res := nt.Send(Addresses[0], &nt.Package{
+		res := nt.Request(Addresses[0], &nt.Package{
 			Option: GET_BLOCK,
 			Data: fmt.Sprintf("%d", i),
 		})
@@ -216,19 +238,24 @@ func chainTX(splited []string) {
 		fmt.Println("strconv error")
 		return
 	}
+	var tx *bc.Transaction
 	for _, addr := range Addresses {
-		res := nt.Send(addr, &nt.Package{
+		res := nt.Request(addr, &nt.Package{
 			Option: GET_LHASH,
 		})
-		if res == nil {
+		if res == nil || res.Data == "" {
 			continue
 		}
-		tx := bc.NewTransaction(User, bc.Base64Decode(res.Data), splited[1], uint64(num))
-		if tx == nil {
-			fmt.Println("tx is null")
-			return
-		}
-		res = nt.Send(addr, &nt.Package{
+		tx = bc.NewTransaction(User, bc.Base64Decode(res.Data), splited[1], uint64(num))
+		break
+	}
+	if tx == nil {
+		fmt.Println("tx is null")
+		return
+	}
+	fmt.Printf("tx: %s\n", bc.Base64Encode(tx.CurrHash))
+	for _, addr := range Addresses {
+		res := nt.Request(addr, &nt.Package{
 			Option: ADD_TRNSX,
 			Data: bc.SerializeTX(tx),
 		})
@@ -254,7 +281,7 @@ func chainBalance(splited []string) {
 
 func printBalance(address string) {
 	for _, addr := range Addresses {
-		res := nt.Send(addr, &nt.Package{
+		res := nt.Request(addr, &nt.Package{
 			Option: GET_BLNCE,
 			Data: address,
 		})
@@ -267,7 +294,7 @@ func printBalance(address string) {
 }
 
 func chainSize() {
-	res := nt.Send(Addresses[0], &nt.Package{
+	res := nt.Request(Addresses[0], &nt.Package{
 		Option: GET_CSIZE,
 	})
 	if res == nil || res.Data == "" {
@@ -287,7 +314,7 @@ func chainBlock(splited []string) {
 		fmt.Println("failed: strconv.Atoi(num)")
 		return
 	}
-	res := nt.Send(Addresses[0], &nt.Package{
+	res := nt.Request(Addresses[0], &nt.Package{
 		Option: GET_BLOCK,
 		Data:   fmt.Sprintf("%d", num-1),
 	})
@@ -296,4 +323,148 @@ func chainBlock(splited []string) {
 		return
 	}
 	fmt.Printf("[%d] => %s\n", num, res.Data)
-} 
\ No newline at end of file
+}
+
+func adminBans() {
+	for _, addr := range Addresses {
+		res := nt.Request(addr, &nt.Package{
+			Option: GET_BANS,
+		})
+		if res == nil || res.Data == "" {
+			fmt.Printf("fail: (%s)\n", addr)
+			continue
+		}
+		var bans []nt.Ban
+		err := json.Unmarshal([]byte(res.Data), &bans)
+		if err != nil {
+			fmt.Printf("fail: (%s)\n", addr)
+			continue
+		}
+		fmt.Printf("Bans (%s): %d\n", addr, len(bans))
+		for _, ban := range bans {
+			fmt.Printf("\t%s until %s: %s\n", ban.Address,
+				time.Unix(ban.Until, 0).Format(time.RFC3339), ban.Reason)
+		}
+	}
+	fmt.Println()
+}
+
+func adminUnban(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2")
+		return
+	}
+	for _, addr := range Addresses {
+		res := nt.Request(addr, &nt.Package{
+			Option: DEL_BANS,
+			Data:   splited[1],
+		})
+		if res == nil {
+			continue
+		}
+		if res.Data == "ok" {
+			fmt.Printf("ok: (%s)\n", addr)
+		} else {
+			fmt.Printf("fail: (%s)\n", addr)
+		}
+	}
+	fmt.Println()
+}
+
+func txStatus(splited []string) {
+	if len(splited) != 2 && len(splited) != 3 {
+		fmt.Println("failed: len(splited) != 2")
+		return
+	}
+	target := uint64(1)
+	if len(splited) == 3 {
+		num, err := strconv.ParseUint(splited[2], 10, 64)
+		if err != nil {
+			fmt.Println("failed: strconv.ParseUint(confirmations)")
+			return
+		}
+		target = num
+	}
+	var last string
+	for i := 0; i < TX_POLL_LIMIT; i++ {
+		info := getTransaction(splited[1])
+		status := "unknown"
+		if info != nil {
+			status = info.Status
+			if info.Status == "included" {
+				status = fmt.Sprintf("included at height %d with %d confirmations",
+					info.Height, info.Confirmations)
+			}
+		}
+		if status != last {
+			fmt.Printf("Status: %s\n", status)
+			last = status
+		}
+		if info != nil && info.Status == "dropped" {
+			break
+		}
+		if info != nil && info.Status == "included" && info.Confirmations >= target {
+			break
+		}
+		time.Sleep(TX_POLL_TIME * time.Second)
+	}
+	fmt.Println()
+}
+
+func getTransaction(hash string) *TransactionInfo {
+	for _, addr := range Addresses {
+		res := nt.Request(addr, &nt.Package{
+			Option: GET_TRNSX,
+			Data:   hash,
+		})
+		if res == nil || res.Data == "" {
+			continue
+		}
+		var info TransactionInfo
+		err := json.Unmarshal([]byte(res.Data), &info)
+		if err != nil {
+			continue
+		}
+		return &info
+	}
+	return nil
+}
+
+func userHistory(splited []string) {
+	if len(splited) > 2 {
+		fmt.Println("failed: len(splited) > 2")
+		return
+	}
+	page := uint64(1)
+	if len(splited) == 2 {
+		num, err := strconv.ParseUint(splited[1], 10, 64)
+		if err != nil || num == 0 {
+			fmt.Println("failed: strconv.ParseUint(page)")
+			return
+		}
+		page = num
+	}
+	res := nt.Request(Addresses[0], &nt.Package{
+		Option: GET_HISTR,
+		Data: User.Address() + SEPARATOR +
+			fmt.Sprintf("%d", (page-1)*HISTORY_PAGE) + SEPARATOR +
+			fmt.Sprintf("%d", HISTORY_PAGE),
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getHistory")
+		return
+	}
+	var history []bc.HistoryEntry
+	err := json.Unmarshal([]byte(res.Data), &history)
+	if err != nil {
+		fmt.Println("failed: json.Unmarshal(history)")
+		return
+	}
+	fmt.Printf("History (page %d):\n", page)
+	for _, entry := range history {
+		fmt.Printf("height %d, %s: %-4s %d coins (fee %d) %s\n",
+			entry.Height, time.Unix(entry.TimeStamp, 0).Format(time.RFC3339), entry.Direction,
+			entry.Amount, entry.Fee, entry.Counterparty)
+	}
+	fmt.Println()
+}
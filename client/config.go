@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	ENV_PREFIX = "CLIENT_"
+)
+
+var CONFIG_NAMES = []string{
+	"nodes", "addrfile", "key", "spec",
+}
+
+type Config struct {
+	Nodes    []string `json:"nodes"`
+	AddrFile string   `json:"addrFile"`
+	Key      string   `json:"key"`
+	Spec     string   `json:"spec"`
+
+	chainSpec *bc.ChainSpec
+}
+
+func loadConfig(args []string) (*Config, error) {
+	var (
+		flags      = flag.NewFlagSet("client", flag.ContinueOnError)
+		configPath = flags.String("config", "", "path to a JSON config file (env CLIENT_CONFIG)")
+		values     = make(map[string]*string)
+		problems   []string
+	)
+	for _, name := range CONFIG_NAMES {
+		values[name] = new(string)
+	}
+	flags.StringVar(values["nodes"], "nodes", "", "comma separated node addresses")
+	flags.StringVar(values["addrfile"], "addrfile", "", "JSON file with a list of node addresses")
+	flags.StringVar(values["key"], "key", "", "private key file, created when missing")
+	flags.StringVar(values["spec"], "spec", "", "chain spec JSON file (default the built-in devnet spec)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(ENV_PREFIX + "CONFIG")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: cannot read %s: %v", path, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+		if err != nil {
+			return nil, fmt.Errorf("config: cannot parse %s: %v", path, err)
+		}
+	}
+
+	for _, name := range CONFIG_NAMES {
+		if value, ok := os.LookupEnv(ENV_PREFIX + strings.ToUpper(name)); ok {
+			config.set(name, value)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok {
+			config.set(f.Name, *value)
+		}
+	})
+
+	problems = append(problems, config.validate()...)
+	if len(problems) != 0 {
+		return nil, errors.New("config:\n\t" + strings.Join(problems, "\n\t"))
+	}
+	return config, nil
+}
+
+func (config *Config) set(name, value string) {
+	switch name {
+	case "nodes":
+		config.Nodes = splitList(value)
+	case "addrfile":
+		config.AddrFile = value
+	case "key":
+		config.Key = value
+	case "spec":
+		config.Spec = value
+	}
+}
+
+func (config *Config) validate() []string {
+	var problems []string
+	if config.AddrFile != "" {
+		var addresses []string
+		data, err := ioutil.ReadFile(config.AddrFile)
+		if err == nil {
+			err = json.Unmarshal(data, &addresses)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("address file %q is unusable: %v", config.AddrFile, err))
+		}
+		config.Nodes = append(config.Nodes, addresses...)
+	}
+	if len(config.Nodes) == 0 {
+		problems = append(problems, "at least one node address is required (-nodes, -addrfile or \"nodes\")")
+	}
+	for _, node := range config.Nodes {
+		if err := validateAddress(node); err != nil {
+			problems = append(problems, fmt.Sprintf("node address %q is invalid: %v", node, err))
+		}
+	}
+	if config.Key == "" {
+		problems = append(problems, "key file is required (-key or \"key\")")
+	}
+	config.chainSpec = bc.DefaultSpec()
+	if config.Spec != "" {
+		spec, err := bc.LoadSpec(config.Spec)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("chain spec %q is unusable: %v", config.Spec, err))
+		} else {
+			config.chainSpec = spec
+		}
+	}
+	return problems
+}
+
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	num, err := strconv.Atoi(port)
+	if err != nil || num <= 0 || num > 65535 {
+		return fmt.Errorf("port %q is not in range 1-65535", port)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
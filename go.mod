@@ -1,5 +1,5 @@
 module github.com/MIHAIL33/CryptoCoin
 
-go 1.18
+go 1.21
 
 require github.com/mattn/go-sqlite3 v1.14.13
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
@@ -12,13 +13,13 @@ const (
 
 func main() {
 	miner := bc.NewUser()
-	bc.NewChain(DBNAME, miner.Address())
+	bc.NewChain(DBNAME, bc.DefaultGenesis(miner.Address()))
 	chain := bc.LoadChain(DBNAME)
 	for i := 0; i < 3; i++ {
 		block := bc.NewBlock(miner.Address(), chain.LastHash())
 		block.AddTransaction(chain, bc.NewTransaction(miner, chain.LastHash(), "SomePeople1", 3))
 		block.AddTransaction(chain, bc.NewTransaction(miner, chain.LastHash(), "SomePeople2", 2))
-		block.Accept(chain, miner, make(chan bool))
+		block.Accept(context.Background(), chain, miner)
 		chain.AddBlock(block)
 	}
 
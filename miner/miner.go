@@ -0,0 +1,189 @@
+package main
+
+// ./miner -rpc http://127.0.0.1:8545
+// MINER_RPC=http://127.0.0.1:8545 ./miner -poll 2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	ENV_PREFIX  = "MINER_"
+	RPC_VERSION = "2.0"
+	POLL_TIME   = 2
+)
+
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (err *RPCError) Error() string {
+	if len(err.Data) != 0 {
+		return fmt.Sprintf("%s (%d): %s", err.Message, err.Code, err.Data)
+	}
+	return fmt.Sprintf("%s (%d)", err.Message, err.Code)
+}
+
+type BlockTemplate struct {
+	ID           string `json:"id"`
+	Height       uint64 `json:"height"`
+	PrevHash     string `json:"prevHash"`
+	Difficulty   uint8  `json:"difficulty"`
+	Target       string `json:"target"`
+	Coinbase     string `json:"coinbase"`
+	TimeStamp    int64  `json:"timeStamp"`
+	Transactions int    `json:"transactions"`
+}
+
+type WorkResult struct {
+	Hash   string `json:"hash"`
+	Height uint64 `json:"height"`
+}
+
+type ChainInfo struct {
+	Size     uint64 `json:"size"`
+	LastHash string `json:"lastHash"`
+}
+
+var (
+	Log    = slog.Default().With("component", "miner")
+	Client = &http.Client{Timeout: 10 * time.Second}
+	RPCURL string
+	Poll   time.Duration
+)
+
+func main() {
+	var (
+		flags = flag.NewFlagSet("miner", flag.ContinueOnError)
+		url   = flags.String("rpc", os.Getenv(ENV_PREFIX+"RPC"), "node HTTP API url, e.g. http://127.0.0.1:8545 (env MINER_RPC)")
+		poll  = flags.Int("poll", POLL_TIME, "seconds between checks for a new chain tip")
+	)
+	err := flags.Parse(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	if *url == "" || *poll <= 0 {
+		fmt.Fprintln(os.Stderr, "miner: -rpc is required and -poll must be positive")
+		os.Exit(2)
+	}
+	RPCURL = *url
+	Poll = time.Duration(*poll) * time.Second
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	Log.Info("miner started", "rpc", RPCURL)
+	for ctx.Err() == nil {
+		mineOnce(ctx)
+	}
+	Log.Info("miner stopped")
+}
+
+func mineOnce(ctx context.Context) {
+	var work BlockTemplate
+	err := call("getBlockTemplate", &work)
+	if err != nil {
+		Log.Debug("no work", "reason", err)
+		sleep(ctx, Poll)
+		return
+	}
+	Log.Info("mining template", "id", work.ID, "height", work.Height,
+		"transactions", work.Transactions, "difficulty", work.Difficulty)
+	search, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go watchTip(search, cancel, work.PrevHash)
+	nonce, err := bc.ProofOfWork(search, bc.Base64Decode(work.ID), work.Difficulty)
+	if errors.Is(err, context.Canceled) {
+		if ctx.Err() == nil {
+			Log.Info("chain tip changed, dropping template", "id", work.ID)
+		}
+		return
+	}
+	if err != nil {
+		Log.Info("mining failed", "id", work.ID, "reason", err)
+		return
+	}
+	var result WorkResult
+	err = call("submitWork", &result, work.ID, nonce)
+	if err != nil {
+		Log.Info("work rejected", "id", work.ID, "nonce", nonce, "reason", err)
+		return
+	}
+	Log.Info("block mined", "hash", result.Hash, "height", result.Height,
+		"nonce", nonce, "hash_rate", bc.HashRate())
+}
+
+func watchTip(ctx context.Context, cancel context.CancelFunc, prevHash string) {
+	ticker := time.NewTicker(Poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var info ChainInfo
+		err := call("getChainInfo", &info)
+		if err != nil {
+			Log.Debug("cannot poll chain tip", "reason", err)
+			continue
+		}
+		if info.LastHash != prevHash {
+			cancel()
+			return
+		}
+	}
+}
+
+func call(method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": RPC_VERSION,
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := Client.Post(RPCURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&reply)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,130 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Ban struct {
+	Address string
+	Score   int
+	Until   int64
+	Reason  string
+}
+
+type BanList struct {
+	mutex    sync.Mutex
+	filename string
+	bans     map[string]*Ban
+}
+
+func NewBanList(filename string) *BanList {
+	list := &BanList{
+		filename: filename,
+		bans:     make(map[string]*Ban),
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return list
+	}
+	bans := []*Ban{}
+	err = json.Unmarshal(data, &bans)
+	if err != nil {
+		logger.Warn("cannot parse ban list", "file", filename, "err", err)
+		return list
+	}
+	for _, ban := range bans {
+		if ban.Address == "" {
+			continue
+		}
+		list.bans[ban.Address] = ban
+	}
+	return list
+}
+
+func (list *BanList) Misbehave(address string, score int, reason string) bool {
+	if address == "" {
+		return false
+	}
+	list.mutex.Lock()
+	ban, ok := list.bans[address]
+	if !ok {
+		ban = &Ban{
+			Address: address,
+		}
+		list.bans[address] = ban
+	}
+	ban.Score += score
+	ban.Reason = reason
+	banned := ban.Score >= BANSCORE
+	if banned {
+		ban.Score = 0
+		ban.Until = time.Now().Add(BANTIME * time.Second).Unix()
+	}
+	list.mutex.Unlock()
+	logger.Info("peer misbehaved", "peer", address, "score", score, "reason", reason)
+	if banned {
+		logger.Warn("peer banned", "peer", address, "reason", reason)
+		list.Save()
+	}
+	return banned
+}
+
+func (list *BanList) IsBanned(address string) bool {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	ban, ok := list.bans[address]
+	if !ok {
+		return false
+	}
+	return ban.Until > time.Now().Unix()
+}
+
+func (list *BanList) Unban(address string) bool {
+	list.mutex.Lock()
+	_, ok := list.bans[address]
+	delete(list.bans, address)
+	list.mutex.Unlock()
+	if ok {
+		list.Save()
+	}
+	return ok
+}
+
+func (list *BanList) Bans() []Ban {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	result := []Ban{}
+	now := time.Now().Unix()
+	for _, ban := range list.bans {
+		if ban.Until <= now {
+			continue
+		}
+		result = append(result, *ban)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+	return result
+}
+
+func (list *BanList) Save() error {
+	list.mutex.Lock()
+	bans := []*Ban{}
+	now := time.Now().Unix()
+	for _, ban := range list.bans {
+		if ban.Until <= now {
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	data, err := json.MarshalIndent(bans, "", "\t")
+	list.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(list.filename, data, 0644)
+}
@@ -0,0 +1,99 @@
+package network
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Rate struct {
+	PerSecond float64 `json:"perSecond"`
+	Burst     float64 `json:"burst"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	mutex   sync.Mutex
+	config  *Config
+	conns   int
+	hosts   map[string]int
+	buckets map[string]*bucket
+}
+
+func newLimiter(config *Config) *limiter {
+	return &limiter{
+		config:  config,
+		hosts:   make(map[string]int),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (lim *limiter) connect(host string) error {
+	lim.mutex.Lock()
+	defer lim.mutex.Unlock()
+	if lim.config.MaxInbound > 0 && lim.conns >= lim.config.MaxInbound {
+		return ErrTooManyConns
+	}
+	if lim.config.MaxPerHost > 0 && lim.hosts[host] >= lim.config.MaxPerHost {
+		return ErrTooManyHost
+	}
+	lim.conns++
+	lim.hosts[host]++
+	return nil
+}
+
+func (lim *limiter) disconnect(host string) {
+	lim.mutex.Lock()
+	defer lim.mutex.Unlock()
+	lim.conns--
+	lim.hosts[host]--
+	if lim.hosts[host] <= 0 {
+		delete(lim.hosts, host)
+	}
+}
+
+func (lim *limiter) allow(host string, option int) error {
+	rate, ok := lim.config.Rates[option]
+	if !ok {
+		return nil
+	}
+	lim.mutex.Lock()
+	defer lim.mutex.Unlock()
+	var (
+		now = time.Now()
+		key = host + "/" + strconv.Itoa(option)
+	)
+	b, ok := lim.buckets[key]
+	if !ok {
+		if len(lim.buckets) >= MAXBUCKETS {
+			lim.sweep(now)
+		}
+		b = &bucket{
+			tokens: rate.Burst,
+			last:   now,
+		}
+		lim.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate.PerSecond
+	if b.tokens > rate.Burst {
+		b.tokens = rate.Burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return ErrRateLimited
+	}
+	b.tokens--
+	return nil
+}
+
+func (lim *limiter) sweep(now time.Time) {
+	for key, b := range lim.buckets {
+		if now.Sub(b.last) > SWEEPTIME*time.Second {
+			delete(lim.buckets, key)
+		}
+	}
+}
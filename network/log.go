@@ -0,0 +1,9 @@
+package network
+
+import "log/slog"
+
+var logger = slog.Default().With("component", "network")
+
+func SetLogger(base *slog.Logger) {
+	logger = base.With("component", "network")
+}
@@ -1,67 +1,173 @@
 package network
 
 import (
+	"encoding/json"
+	"errors"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Listener net.Listener
 type Conn net.Conn
 
+type listener struct {
+	net.Listener
+	conns sync.WaitGroup
+	done  chan bool
+}
+
+type Config struct {
+	MaxInbound int
+	MaxPerHost int
+	Rates      map[int]Rate
+	IsBanned   func(host string) bool
+	Misbehave  func(host string, err error)
+}
+
+var (
+	ErrOversized    = errors.New("package is oversized")
+	ErrMalformed    = errors.New("package is malformed")
+	ErrTooManyConns = errors.New("too many connections")
+	ErrTooManyHost  = errors.New("too many connections from host")
+	ErrRateLimited  = errors.New("rate limit exceeded")
+)
+
 func Listen(address string, handle func(Conn, *Package)) Listener {
+	return ListenConfig(address, &Config{}, handle)
+}
+
+func ListenConfig(address string, config *Config, handle func(Conn, *Package)) Listener {
 	splited := strings.Split(address, ":")
 	if len(splited) != 2 {
+		logger.Error("cannot listen", "address", address, "err", "address must be host:port")
 		return nil
 	}
-	listener, err := net.Listen("tcp", "0.0.0.0:" + splited[1])
+	ln, err := net.Listen("tcp", "0.0.0.0:" + splited[1])
 	if err != nil {
+		logger.Error("cannot listen", "address", address, "err", err)
 		return nil
 	}
+	logger.Info("listening", "address", ln.Addr().String())
+	listener := &listener{
+		Listener: ln,
+		done:     make(chan bool),
+	}
 
-	go serve(listener, handle)
+	go serve(listener, config, handle)
 
 	return Listener(listener)
 }
 
+func (listener *listener) Close() error {
+	err := listener.Listener.Close()
+	<-listener.done
+	listener.conns.Wait()
+	return err
+}
+
 func Handle(option int, conn Conn, pack *Package, handle func(*Package)string) bool {
 	if pack.Option != option {
 		return false
 	}
-	conn.Write([]byte(SerializePackage(&Package{
+	n, _ := conn.Write([]byte(SerializePackage(&Package{
 		Option: option,
 		Data: handle(pack),
 	}) + ENDBYTES))
+	countTraffic(option, 0, n)
 	return true
 }
 
-func serve(listener net.Listener, handle func(Conn, *Package)) {
-	defer listener.Close()
+func serve(listener *listener, config *Config, handle func(Conn, *Package)) {
+	defer close(listener.done)
+	defer listener.Listener.Close()
+	lim := newLimiter(config)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			break
 		}
-		go handleConn(conn, handle)
+		host := RemoteHost(conn)
+		if config.IsBanned != nil && config.IsBanned(host) {
+			logger.Debug("connection refused", "host", host, "reason", "banned")
+			conn.Close()
+			continue
+		}
+		err = lim.connect(host)
+		if err != nil {
+			logger.Info("connection refused", "host", host, "reason", err)
+			go reject(conn, err)
+			continue
+		}
+		listener.conns.Add(1)
+		atomic.AddInt64(&connections, 1)
+		go func() {
+			defer listener.conns.Done()
+			defer atomic.AddInt64(&connections, -1)
+			defer lim.disconnect(host)
+			handleConn(conn, host, config, lim, handle)
+		}()
 	}
 }
 
-func handleConn(conn net.Conn, handle func(Conn, *Package)) {
+func handleConn(conn net.Conn, host string, config *Config, lim *limiter, handle func(Conn, *Package)) {
 	defer conn.Close()
-	pack := readPackage(conn)
-	if pack == nil {
+	conn.SetReadDeadline(time.Now().Add(WAITTIME * time.Second))
+	pack, size, err := receivePackage(conn)
+	if err != nil {
+		if err == ErrOversized || err == ErrMalformed {
+			logger.Info("package rejected", "host", host, "reason", err)
+			if config.Misbehave != nil {
+				config.Misbehave(host, err)
+			}
+			return
+		}
+		logger.Debug("cannot read package", "host", host, "err", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	countTraffic(pack.Option, size, 0)
+	err = lim.allow(host, pack.Option)
+	if err != nil {
+		logger.Info("package rejected", "host", host, "option", pack.Option, "reason", err)
+		writeError(conn, err)
 		return
 	}
 	handle(Conn(conn), pack)
 }
 
+func reject(conn net.Conn, err error) {
+	defer conn.Close()
+	writeError(conn, err)
+}
+
+func writeError(conn net.Conn, err error) {
+	n, _ := conn.Write([]byte(SerializePackage(&Package{
+		Option: ERRORPACK,
+		Data:   err.Error(),
+	}) + ENDBYTES))
+	countTraffic(ERRORPACK, 0, n)
+}
+
+func RemoteHost(conn Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
 func Send(address string, pack *Package) *Package {
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
+		logger.Debug("cannot send package", "address", address, "option", pack.Option, "err", err)
 		return nil
 	}
 	defer conn.Close()
-	conn.Write([]byte(SerializePackage(pack) + ENDBYTES))
+	n, _ := conn.Write([]byte(SerializePackage(pack) + ENDBYTES))
+	countTraffic(pack.Option, 0, n)
 
 	var (
 		res = new(Package)
@@ -76,12 +182,32 @@ func Send(address string, pack *Package) *Package {
 	select {
 	case <-ch:
 	case <-time.After(WAITTIME * time.Second):
+		logger.Debug("no response", "address", address, "option", pack.Option)
 	}
 
 	return res
 }
 
+// Request is Send that treats error replies, such as a rate limit,
+// and replies to another option as no reply.
+func Request(address string, pack *Package) *Package {
+	res := Send(address, pack)
+	if res == nil || res.Option != pack.Option {
+		return nil
+	}
+	return res
+}
+
 func readPackage(conn net.Conn) *Package {
+	pack, size, err := receivePackage(conn)
+	if err != nil {
+		return nil
+	}
+	countTraffic(pack.Option, size, 0)
+	return pack
+}
+
+func receivePackage(conn net.Conn) (*Package, int, error) {
 	var (
 		data string
 		size = uint64(0)
@@ -91,11 +217,11 @@ func readPackage(conn net.Conn) *Package {
 	for {
 		length, err := conn.Read(buffer)
 		if err != nil {
-			return nil
+			return nil, int(size), err
 		}
 		size += uint64(length)
 		if size > DMAXSIZE {
-			return nil
+			return nil, int(size), ErrOversized
 		}
 
 		data += string(buffer[:length])
@@ -104,6 +230,11 @@ func readPackage(conn net.Conn) *Package {
 			break
 		}
 	}
-	return DeserializePackage(data)
+	var pack Package
+	err := json.Unmarshal([]byte(data), &pack)
+	if err != nil {
+		return nil, int(size), ErrMalformed
+	}
+	return &pack, int(size), nil
 }
 
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Peer struct {
+	Address  string
+	LastSeen int64
+	Failures int
+}
+
+type PeerStore struct {
+	mutex    sync.Mutex
+	filename string
+	peers    map[string]*Peer
+}
+
+func NewPeerStore(filename string) *PeerStore {
+	store := &PeerStore{
+		filename: filename,
+		peers:    make(map[string]*Peer),
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return store
+	}
+	var peers []*Peer
+	err = json.Unmarshal(data, &peers)
+	if err != nil {
+		logger.Warn("cannot parse peer store", "file", filename, "err", err)
+		return store
+	}
+	for _, peer := range peers {
+		if peer.Address == "" {
+			continue
+		}
+		store.peers[peer.Address] = peer
+	}
+	return store
+}
+
+func (store *PeerStore) Add(address string) bool {
+	if address == "" {
+		return false
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.peers[address]; ok {
+		return false
+	}
+	if len(store.peers) >= MAXPEERS {
+		return false
+	}
+	store.peers[address] = &Peer{
+		Address: address,
+	}
+	logger.Debug("peer added", "peer", address)
+	return true
+}
+
+func (store *PeerStore) Seen(address string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	peer, ok := store.peers[address]
+	if !ok {
+		return
+	}
+	peer.LastSeen = time.Now().Unix()
+	peer.Failures = 0
+}
+
+func (store *PeerStore) Fail(address string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	peer, ok := store.peers[address]
+	if !ok {
+		return
+	}
+	peer.Failures++
+	if peer.Failures >= MAXFAILURES {
+		logger.Info("peer dropped", "peer", address, "failures", peer.Failures)
+		delete(store.peers, address)
+	}
+}
+
+func (store *PeerStore) Addresses() []string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var list []string
+	for addr := range store.peers {
+		list = append(list, addr)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (store *PeerStore) Peers() []Peer {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	list := []Peer{}
+	for _, peer := range store.peers {
+		list = append(list, *peer)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+func (store *PeerStore) Save() error {
+	data, err := json.MarshalIndent(store.Peers(), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(store.filename, data, 0644)
+}
+
+func (store *PeerStore) Remove(address string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.peers, address)
+}
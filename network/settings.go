@@ -10,4 +10,20 @@ const (
 	WAITTIME = 5
 	DMAXSIZE = (2 << 20) // (2^20)*2 = 2MiB
 	BUFFSIZE = (4 << 10) // (2^10)*4 = 4KiB
+	ERRORPACK = -1
+)
+
+const (
+	MAXPEERS = 128
+	MAXFAILURES = 5
+)
+
+const (
+	BANSCORE = 100
+	BANTIME = 24 * 60 * 60
+)
+
+const (
+	MAXBUCKETS = 4096
+	SWEEPTIME = 60
 )
\ No newline at end of file
@@ -0,0 +1,43 @@
+package network
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Traffic struct {
+	In  uint64
+	Out uint64
+}
+
+var (
+	trafficMutex sync.Mutex
+	traffic      = make(map[int]*Traffic)
+	connections  int64
+)
+
+func TrafficStats() map[int]Traffic {
+	trafficMutex.Lock()
+	defer trafficMutex.Unlock()
+	stats := make(map[int]Traffic, len(traffic))
+	for option, count := range traffic {
+		stats[option] = *count
+	}
+	return stats
+}
+
+func Connections() int64 {
+	return atomic.LoadInt64(&connections)
+}
+
+func countTraffic(option int, in, out int) {
+	trafficMutex.Lock()
+	defer trafficMutex.Unlock()
+	count, ok := traffic[option]
+	if !ok {
+		count = new(Traffic)
+		traffic[option] = count
+	}
+	count.In += uint64(in)
+	count.Out += uint64(out)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	SCORE_INVALID_BLOCK = 100
+	SCORE_INVALID_TRNSX = 10
+	SCORE_FALSE_CHAIN   = 50
+	SCORE_MALFORMED     = 20
+	SCORE_OVERSIZED     = 50
+	SCORE_INVALID_TIME  = 20
+)
+
+func misbehave(address string, score int, reason string) {
+	host := peerHost(address)
+	if !Bans.Misbehave(host, score, reason) || isLoopback(host) {
+		return
+	}
+	for _, addr := range Peers.Addresses() {
+		if peerHost(addr) == host {
+			Log.Info("peer removed", "peer", addr, "reason", "banned")
+			Peers.Remove(addr)
+		}
+	}
+}
+
+func validationScore(err error) int {
+	switch {
+	case errors.Is(err, bc.ErrTimestamp):
+		return SCORE_INVALID_TIME
+	case errors.Is(err, bc.ErrPrevBlock), errors.Is(err, bc.ErrCheckpoint):
+		return SCORE_FALSE_CHAIN
+	}
+	return SCORE_INVALID_BLOCK
+}
+
+func misbehavePackage(host string, err error) {
+	switch err {
+	case nt.ErrOversized:
+		misbehave(host, SCORE_OVERSIZED, err.Error())
+	case nt.ErrMalformed:
+		misbehave(host, SCORE_MALFORMED, err.Error())
+	}
+}
+
+func addPeer(address string) {
+	if address == "" || isSelf(address) || isBannedHost(peerHost(address)) {
+		return
+	}
+	Peers.Add(address)
+}
+
+// Scores and bans are keyed by host, an address without host is local.
+func peerHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if host == "" {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// The dial-back address of an inbound peer is its remote host
+// with the port it listens on, never a host it claims.
+func peerAddress(host, reported string) string {
+	_, port, err := net.SplitHostPort(reported)
+	if err != nil || port == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// A gossiped address without host belongs to the peer that sent it.
+func gossipAddress(sender, address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ""
+	}
+	if host != "" {
+		return address
+	}
+	return peerAddress(peerHost(sender), address)
+}
+
+// An address without host is only meaningful to local peers.
+func sharedAddress(host, address string) string {
+	addrHost, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ""
+	}
+	if addrHost != "" {
+		return address
+	}
+	if !isLoopback(host) {
+		return ""
+	}
+	return peerAddress("127.0.0.1", address)
+}
+
+func isSelf(address string) bool {
+	if address == Serve {
+		return true
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	serveHost, servePort, err := net.SplitHostPort(Serve)
+	if err != nil || port != servePort {
+		return false
+	}
+	return host == serveHost || isLoopback(peerHost(address))
+}
+
+func isBannedHost(host string) bool {
+	if isLoopback(host) {
+		return false
+	}
+	return Bans.IsBanned(host)
+}
+
+func isLocal(conn nt.Conn) bool {
+	return isLoopback(nt.RemoteHost(conn))
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func getBans(pack *nt.Package) string {
+	data, err := json.Marshal(Bans.Bans())
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func delBan(pack *nt.Package) string {
+	if !Bans.Unban(pack.Data) {
+		return "fail"
+	}
+	return "ok"
+}
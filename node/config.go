@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	ENV_PREFIX = "NODE_"
+)
+
+var CONFIG_NAMES = []string{
+	"listen", "peers", "addrfile", "key", "db", "peerstore",
+	"banlist", "mining", "rpc", "remotework", "maxinbound", "maxperhost", "maxsyncjobs", "rates",
+	"loglevel", "logformat", "coinbase", "blocktime", "spec", "genesis",
+	"checkpoints", "assumevalid",
+}
+
+type Config struct {
+	Listen      string             `json:"listen"`
+	Peers       []string           `json:"peers"`
+	AddrFile    string             `json:"addrFile"`
+	Key         string             `json:"key"`
+	DB          string             `json:"db"`
+	PeerStore   string             `json:"peerStore"`
+	BanList     string             `json:"banList"`
+	Mining      bool               `json:"mining"`
+	Coinbase    string             `json:"coinbase"`
+	BlockTime   int                `json:"blockTime"`
+	RPC         string             `json:"rpc"`
+	RemoteWork  bool               `json:"remoteWork"`
+	MaxInbound  int                `json:"maxInbound"`
+	MaxPerHost  int                `json:"maxPerHost"`
+	MaxSyncJobs int                `json:"maxSyncJobs"`
+	Rates       map[string]nt.Rate `json:"rates"`
+	LogLevel    string             `json:"logLevel"`
+	LogFormat   string             `json:"logFormat"`
+	Spec        string             `json:"spec"`
+	Genesis     string             `json:"genesis"`
+	Checkpoints []string           `json:"checkpoints"`
+	AssumeValid string             `json:"assumeValid"`
+
+	chainSpec   *bc.ChainSpec
+	genesis     *bc.Genesis
+	checkpoints bc.Checkpoints
+	rates       map[int]nt.Rate
+}
+
+func defaultConfig() *Config {
+	rates := make(map[string]nt.Rate)
+	for option, rate := range Rates {
+		rates[OpcodeNames[option]] = rate
+	}
+	return &Config{
+		Mining:      true,
+		BlockTime:   BLOCK_TIME,
+		MaxInbound:  MAX_INBOUND,
+		MaxPerHost:  MAX_PER_HOST,
+		MaxSyncJobs: MAX_SYNC_JOBS,
+		Rates:       rates,
+		LogLevel:    "info",
+		LogFormat:   LOG_TEXT,
+	}
+}
+
+func loadConfig(args []string) (*Config, error) {
+	var (
+		flags      = flag.NewFlagSet("node", flag.ContinueOnError)
+		configPath = flags.String("config", "", "path to a JSON config file (env NODE_CONFIG)")
+		values     = make(map[string]*string)
+		problems   []string
+	)
+	for _, name := range CONFIG_NAMES {
+		values[name] = new(string)
+	}
+	flags.StringVar(values["listen"], "listen", "", "address to accept peers on, e.g. :8080")
+	flags.StringVar(values["peers"], "peers", "", "comma separated seed peer addresses")
+	flags.StringVar(values["addrfile"], "addrfile", "", "JSON file with a list of seed peer addresses")
+	flags.StringVar(values["key"], "key", "", "private key file, created when missing")
+	flags.StringVar(values["db"], "db", "", "chain database file, created when missing")
+	flags.StringVar(values["spec"], "spec", "", "chain spec JSON file (default the built-in devnet spec)")
+	flags.StringVar(values["genesis"], "genesis", "", "genesis JSON file with timestamp, allocations and spec")
+	flags.StringVar(values["checkpoints"], "checkpoints", "", "comma separated height:hash blocks the chain must contain")
+	flags.StringVar(values["assumevalid"], "assumevalid", "", "block hash up to which signatures are not checked during sync")
+	flags.StringVar(values["peerstore"], "peerstore", "", "peer store file (default <db>"+PEERS_SUFFIX+")")
+	flags.StringVar(values["banlist"], "banlist", "", "ban list file (default <db>"+BANS_SUFFIX+")")
+	flags.StringVar(values["mining"], "mining", "", "mine blocks: true or false (default true)")
+	flags.StringVar(values["coinbase"], "coinbase", "", "address that receives mining rewards (default the node key)")
+	flags.StringVar(values["blocktime"], "blocktime", "", fmt.Sprintf("seconds after the last block to mine a partial or empty block, 0 to wait for full blocks (default %d)", BLOCK_TIME))
+	flags.StringVar(values["rpc"], "rpc", "", "address for the HTTP API, disabled when empty")
+	flags.StringVar(values["remotework"], "remotework", "", "serve getBlockTemplate and submitWork to non-local callers: true or false (default false)")
+	flags.StringVar(values["maxinbound"], "maxinbound", "", fmt.Sprintf("max inbound connections (default %d)", MAX_INBOUND))
+	flags.StringVar(values["maxperhost"], "maxperhost", "", fmt.Sprintf("max connections per host (default %d)", MAX_PER_HOST))
+	flags.StringVar(values["maxsyncjobs"], "maxsyncjobs", "", fmt.Sprintf("max chains synced at once (default %d)", MAX_SYNC_JOBS))
+	flags.StringVar(values["rates"], "rates", "", "comma separated per-host package limits as opcode=perSecond/burst, e.g. get_data=100/200, 0/0 for no limit")
+	flags.StringVar(values["loglevel"], "loglevel", "", "log level: debug, info, warn or error (default info)")
+	flags.StringVar(values["logformat"], "logformat", "", "log format: text or json (default text)")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultConfig()
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(ENV_PREFIX + "CONFIG")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: cannot read %s: %v", path, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+		if err != nil {
+			return nil, fmt.Errorf("config: cannot parse %s: %v", path, err)
+		}
+	}
+
+	for _, name := range CONFIG_NAMES {
+		env := ENV_PREFIX + strings.ToUpper(name)
+		if value, ok := os.LookupEnv(env); ok {
+			problems = append(problems, config.set(name, value, "environment variable "+env)...)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok {
+			problems = append(problems, config.set(f.Name, *value, "flag -"+f.Name)...)
+		}
+	})
+
+	problems = append(problems, config.validate()...)
+	if len(problems) != 0 {
+		return nil, errors.New("config:\n\t" + strings.Join(problems, "\n\t"))
+	}
+	return config, nil
+}
+
+func (config *Config) set(name, value, source string) []string {
+	switch name {
+	case "listen":
+		config.Listen = value
+	case "peers":
+		config.Peers = splitList(value)
+	case "addrfile":
+		config.AddrFile = value
+	case "key":
+		config.Key = value
+	case "db":
+		config.DB = value
+	case "spec":
+		config.Spec = value
+	case "genesis":
+		config.Genesis = value
+	case "checkpoints":
+		config.Checkpoints = splitList(value)
+	case "assumevalid":
+		config.AssumeValid = value
+	case "peerstore":
+		config.PeerStore = value
+	case "banlist":
+		config.BanList = value
+	case "rpc":
+		config.RPC = value
+	case "coinbase":
+		config.Coinbase = value
+	case "loglevel":
+		config.LogLevel = value
+	case "logformat":
+		config.LogFormat = value
+	case "mining":
+		mining, err := strconv.ParseBool(value)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %q is not true or false", source, value)}
+		}
+		config.Mining = mining
+	case "remotework":
+		remote, err := strconv.ParseBool(value)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %q is not true or false", source, value)}
+		}
+		config.RemoteWork = remote
+	case "rates":
+		var problems []string
+		for _, item := range splitList(value) {
+			name, rate, err := parseRate(item)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", source, err))
+				continue
+			}
+			config.Rates[name] = rate
+		}
+		return problems
+	case "maxinbound", "maxperhost", "maxsyncjobs", "blocktime":
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %q is not a number", source, value)}
+		}
+		switch name {
+		case "maxinbound":
+			config.MaxInbound = num
+		case "maxperhost":
+			config.MaxPerHost = num
+		case "maxsyncjobs":
+			config.MaxSyncJobs = num
+		case "blocktime":
+			config.BlockTime = num
+		}
+	}
+	return nil
+}
+
+func (config *Config) validate() []string {
+	var problems []string
+	if config.Listen == "" {
+		problems = append(problems, "listen address is required (-listen or \"listen\")")
+	} else if err := validateAddress(config.Listen); err != nil {
+		problems = append(problems, fmt.Sprintf("listen address %q is invalid: %v", config.Listen, err))
+	}
+	if config.RPC != "" {
+		if err := validateAddress(config.RPC); err != nil {
+			problems = append(problems, fmt.Sprintf("rpc address %q is invalid: %v", config.RPC, err))
+		}
+	}
+	if config.AddrFile != "" {
+		var addresses []string
+		data, err := ioutil.ReadFile(config.AddrFile)
+		if err == nil {
+			err = json.Unmarshal(data, &addresses)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("address file %q is unusable: %v", config.AddrFile, err))
+		}
+		config.Peers = append(config.Peers, addresses...)
+	}
+	for _, peer := range config.Peers {
+		if err := validateAddress(peer); err != nil {
+			problems = append(problems, fmt.Sprintf("peer address %q is invalid: %v", peer, err))
+		}
+	}
+	if config.Coinbase != "" && bc.ParsePublic(config.Coinbase) == nil {
+		problems = append(problems, fmt.Sprintf("coinbase %q is not a valid address", config.Coinbase))
+	}
+	if config.Key == "" {
+		problems = append(problems, "key file is required (-key or \"key\")")
+	}
+	if config.DB == "" {
+		problems = append(problems, "database file is required (-db or \"db\")")
+	}
+	config.chainSpec = bc.DefaultSpec()
+	if config.Spec != "" {
+		spec, err := bc.LoadSpec(config.Spec)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("chain spec %q is unusable: %v", config.Spec, err))
+		} else {
+			config.chainSpec = spec
+		}
+	}
+	if config.Genesis != "" {
+		genesis, err := bc.LoadGenesis(config.Genesis)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("genesis file %q is unusable: %v", config.Genesis, err))
+		} else if config.Spec != "" {
+			problems = append(problems, "spec and genesis are exclusive, the genesis file carries the chain spec")
+		} else {
+			config.genesis = genesis
+			config.chainSpec = genesis.Spec
+		}
+	}
+	checkpoints, err := bc.ParseCheckpoints(config.Checkpoints)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	config.checkpoints = checkpoints
+	if config.AssumeValid != "" && len(bc.Base64Decode(config.AssumeValid)) != bc.HASH_SIZE {
+		problems = append(problems, fmt.Sprintf("assume-valid hash %q is not a base64 %d byte hash", config.AssumeValid, bc.HASH_SIZE))
+	}
+	if config.MaxInbound < 0 {
+		problems = append(problems, fmt.Sprintf("maxInbound must not be negative, got %d", config.MaxInbound))
+	}
+	if config.MaxPerHost < 0 {
+		problems = append(problems, fmt.Sprintf("maxPerHost must not be negative, got %d", config.MaxPerHost))
+	}
+	if config.MaxSyncJobs < 1 {
+		problems = append(problems, fmt.Sprintf("maxSyncJobs must be positive, got %d", config.MaxSyncJobs))
+	}
+	config.rates = make(map[int]nt.Rate)
+	var names []string
+	for name := range config.Rates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rate := config.Rates[name]
+		option, ok := opcodeByName(name)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("rate for unknown opcode %q", name))
+		case rate.PerSecond < 0 || rate.Burst < 0:
+			problems = append(problems, fmt.Sprintf("rate for %s must not be negative", name))
+		case rate.PerSecond == 0 && rate.Burst == 0:
+		case rate.PerSecond == 0 || rate.Burst < 1:
+			problems = append(problems, fmt.Sprintf("rate for %s needs a positive perSecond and a burst of at least 1, or 0/0 for no limit", name))
+		default:
+			config.rates[option] = rate
+		}
+	}
+	if config.BlockTime < 0 {
+		problems = append(problems, fmt.Sprintf("blockTime must not be negative, got %d", config.BlockTime))
+	}
+	if _, err := parseLogLevel(config.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("log level %v", err))
+	}
+	if config.LogFormat != LOG_TEXT && config.LogFormat != LOG_JSON {
+		problems = append(problems, fmt.Sprintf("log format %q is not one of text, json", config.LogFormat))
+	}
+	if config.PeerStore == "" {
+		config.PeerStore = config.DB + PEERS_SUFFIX
+	}
+	if config.BanList == "" {
+		config.BanList = config.DB + BANS_SUFFIX
+	}
+	return problems
+}
+
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	num, err := strconv.Atoi(port)
+	if err != nil || num <= 0 || num > 65535 {
+		return fmt.Errorf("port %q is not in range 1-65535", port)
+	}
+	return nil
+}
+
+func parseRate(item string) (string, nt.Rate, error) {
+	var rate nt.Rate
+	parts := strings.SplitN(item, "=", 2)
+	if len(parts) != 2 {
+		return "", rate, fmt.Errorf("rate %q is not opcode=perSecond/burst", item)
+	}
+	values := strings.SplitN(parts[1], "/", 2)
+	if len(values) != 2 {
+		return "", rate, fmt.Errorf("rate %q is not opcode=perSecond/burst", item)
+	}
+	perSecond, err := strconv.ParseFloat(values[0], 64)
+	if err != nil {
+		return "", rate, fmt.Errorf("rate %q: perSecond is not a number", item)
+	}
+	burst, err := strconv.ParseFloat(values[1], 64)
+	if err != nil {
+		return "", rate, fmt.Errorf("rate %q: burst is not a number", item)
+	}
+	rate.PerSecond = perSecond
+	rate.Burst = burst
+	return strings.TrimSpace(parts[0]), rate, nil
+}
+
+func opcodeByName(name string) (int, bool) {
+	for option, item := range OpcodeNames {
+		if item == name && option != nt.ERRORPACK {
+			return option, true
+		}
+	}
+	return 0, false
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
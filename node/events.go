@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	SUB_NEW_HEADS   = "newHeads"
+	SUB_PENDING_TXS = "pendingTransactions"
+	SUB_ADDRESS     = "address"
+	SUB_BUFFER      = 64
+	SUB_LIMIT       = 16
+)
+
+type Subscription struct {
+	ID      string
+	Kind    string
+	Address string
+	send    chan []byte
+}
+
+type EventHub struct {
+	mutex sync.Mutex
+	subs  map[string]*Subscription
+}
+
+type HeadEvent struct {
+	Height uint64     `json:"height"`
+	Header *bc.Header `json:"header"`
+	Reorg  bool       `json:"reorg"`
+}
+
+var (
+	Events = NewEventHub()
+)
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subs: make(map[string]*Subscription),
+	}
+}
+
+// Subscribe returns nil once the connection holds SUB_LIMIT subscriptions.
+func (hub *EventHub) Subscribe(kind, address string, send chan []byte) *Subscription {
+	sub := &Subscription{
+		ID:      hex.EncodeToString(bc.GenerateRandomBytes(8)),
+		Kind:    kind,
+		Address: address,
+		send:    send,
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	count := 0
+	for _, other := range hub.subs {
+		if other.send == send {
+			count++
+		}
+	}
+	if count >= SUB_LIMIT {
+		return nil
+	}
+	hub.subs[sub.ID] = sub
+	return sub
+}
+
+func (hub *EventHub) Unsubscribe(id string, send chan []byte) bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	sub, ok := hub.subs[id]
+	if !ok || sub.send != send {
+		return false
+	}
+	delete(hub.subs, id)
+	return true
+}
+
+func (hub *EventHub) UnsubscribeAll(send chan []byte) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for id, sub := range hub.subs {
+		if sub.send == send {
+			delete(hub.subs, id)
+		}
+	}
+}
+
+// The result is marshalled once, outside the hub lock, and wrapped
+// per subscription.
+func (hub *EventHub) publish(match func(*Subscription) bool, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, sub := range hub.subs {
+		if !match(sub) {
+			continue
+		}
+		select {
+		case sub.send <- notification(sub.ID, data):
+		default:
+		}
+	}
+}
+
+// Subscription ids are hex, so they need no escaping.
+func notification(id string, result []byte) []byte {
+	data := make([]byte, 0, len(result)+96)
+	data = append(data, `{"jsonrpc":"`+RPC_VERSION+`","method":"subscription","params":{"subscription":"`...)
+	data = append(data, id...)
+	data = append(data, `","result":`...)
+	data = append(data, result...)
+	return append(data, "}}"...)
+}
+
+func (hub *EventHub) PublishBlock(block *bc.Block, height uint64, reorg bool) {
+	hub.publish(func(sub *Subscription) bool {
+		return sub.Kind == SUB_NEW_HEADS
+	}, &HeadEvent{
+		Height: height,
+		Header: block.Header(),
+		Reorg:  reorg,
+	})
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		hub.publishAddress(tx, &TransactionInfo{
+			Transaction:   tx,
+			Status:        TX_INCLUDED,
+			BlockHash:     bc.Base64Encode(block.CurrHash),
+			Height:        &height,
+			Confirmations: 1,
+		})
+	}
+}
+
+func (hub *EventHub) PublishTransaction(tx *bc.Transaction) {
+	info := &TransactionInfo{
+		Transaction: tx,
+		Status:      TX_PENDING,
+	}
+	hub.publish(func(sub *Subscription) bool {
+		return sub.Kind == SUB_PENDING_TXS || matchAddress(sub, tx)
+	}, info)
+}
+
+func (hub *EventHub) PublishDropped(info *TransactionInfo) {
+	hub.publish(func(sub *Subscription) bool {
+		return sub.Kind == SUB_PENDING_TXS || matchAddress(sub, info.Transaction)
+	}, info)
+}
+
+func (hub *EventHub) publishAddress(tx *bc.Transaction, info *TransactionInfo) {
+	hub.publish(func(sub *Subscription) bool {
+		return matchAddress(sub, tx)
+	}, info)
+}
+
+func matchAddress(sub *Subscription, tx *bc.Transaction) bool {
+	return sub.Kind == SUB_ADDRESS &&
+		(sub.Address == tx.Sender || sub.Address == tx.Receiver)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func listenHTTP(address string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRoot)
+	mux.HandleFunc("/blocks", handleBlocks)
+	mux.HandleFunc("/blocks/", handleBlock)
+	mux.HandleFunc("/tx/", handleTransaction)
+	mux.HandleFunc("/address/", handleAddress)
+	mux.HandleFunc("/ws", handleWebSocket)
+	mux.HandleFunc("/metrics", handleMetrics)
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			HTTPLog.Error("cannot serve http", "address", address, "err", err)
+		}
+	}()
+	HTTPLog.Info("serving http", "address", address)
+	return server
+}
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		restError(w, http.StatusNotFound, "not found")
+		return
+	}
+	handleRPC(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
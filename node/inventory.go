@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	INV_BLOCK = iota + 1
+	INV_TRNSX
+)
+
+const (
+	KNOWN_LIMIT = 1024
+)
+
+type Inventory struct {
+	Type int
+	Hash string
+}
+
+type KnownInventory struct {
+	mutex sync.Mutex
+	peers map[string]map[string]bool
+}
+
+var (
+	Known = NewKnownInventory()
+)
+
+func NewKnownInventory() *KnownInventory {
+	return &KnownInventory{
+		peers: make(map[string]map[string]bool),
+	}
+}
+
+func (known *KnownInventory) Add(peer, hash string) {
+	known.mutex.Lock()
+	defer known.mutex.Unlock()
+	items, ok := known.peers[peer]
+	if !ok || len(items) >= KNOWN_LIMIT {
+		items = make(map[string]bool)
+		known.peers[peer] = items
+	}
+	items[hash] = true
+}
+
+func (known *KnownInventory) Has(peer, hash string) bool {
+	known.mutex.Lock()
+	defer known.mutex.Unlock()
+	return known.peers[peer][hash]
+}
+
+func announceInventory(inv *Inventory) {
+	data, err := json.Marshal([]*Inventory{inv})
+	if err != nil {
+		return
+	}
+	msg := Serve + SEPARATOR + fmt.Sprintf("%d", Chain.Size()) + SEPARATOR + string(data)
+	for _, addr := range Peers.Addresses() {
+		if Known.Has(addr, inv.Hash) {
+			continue
+		}
+		Known.Add(addr, inv.Hash)
+		if !startWorker() {
+			return
+		}
+		go func(addr string) {
+			defer Workers.Done()
+			res := nt.Send(addr, &nt.Package{
+				Option: ADD_INVNT,
+				Data:   msg,
+			})
+			if res == nil {
+				Peers.Fail(addr)
+				return
+			}
+			Peers.Seen(addr)
+		}(addr)
+	}
+}
+
+func addInventory(host string, pack *nt.Package) string {
+	splited := strings.Split(pack.Data, SEPARATOR)
+	if len(splited) != 3 {
+		return "fail"
+	}
+	if isBannedHost(host) {
+		return "fail"
+	}
+	address := peerAddress(host, splited[0])
+	num, err := strconv.ParseUint(splited[1], 10, 64)
+	if address == "" || err != nil {
+		return "fail"
+	}
+	var items []*Inventory
+	err = json.Unmarshal([]byte(splited[2]), &items)
+	if err != nil {
+		Log.Info("inventory rejected", "peer", address, "reason", "malformed inventory")
+		misbehave(address, SCORE_MALFORMED, "malformed inventory")
+		return "fail"
+	}
+	for _, inv := range items {
+		Known.Add(address, inv.Hash)
+	}
+	if !startWorker() {
+		return "fail"
+	}
+	go func() {
+		defer Workers.Done()
+		requestInventory(address, num, items)
+	}()
+	return "ok"
+}
+
+func requestInventory(address string, num uint64, items []*Inventory) {
+	for _, inv := range items {
+		if isStopping() {
+			return
+		}
+		hash := bc.Base64Decode(inv.Hash)
+		switch inv.Type {
+		case INV_BLOCK:
+			if Chain.HasBlock(hash) || Orphans.Has(hash) {
+				continue
+			}
+			res := requestData(address, inv)
+			if res == nil {
+				continue
+			}
+			acceptBlock(address, num, bc.DeserializeBlock(res.Data))
+		case INV_TRNSX:
+			if pendingTransaction(hash) != nil {
+				continue
+			}
+			res := requestData(address, inv)
+			if res == nil {
+				continue
+			}
+			tx := bc.DeserializeTX(res.Data)
+			err := tx.Validate()
+			if err != nil {
+				Log.Info("transaction rejected", "peer", address, "hash", inv.Hash, "reason", err)
+				misbehave(address, SCORE_INVALID_TRNSX, err.Error())
+				continue
+			}
+			acceptTransaction(tx)
+		}
+	}
+}
+
+func requestData(address string, inv *Inventory) *nt.Package {
+	res := nt.Request(address, &nt.Package{
+		Option: GET_DATA,
+		Data:   fmt.Sprintf("%d", inv.Type) + SEPARATOR + inv.Hash,
+	})
+	if res == nil || res.Data == "" {
+		return nil
+	}
+	return res
+}
+
+func getData(pack *nt.Package) string {
+	splited := strings.Split(pack.Data, SEPARATOR)
+	if len(splited) != 2 {
+		return ""
+	}
+	invType, err := strconv.Atoi(splited[0])
+	if err != nil {
+		return ""
+	}
+	hash := bc.Base64Decode(splited[1])
+	switch invType {
+	case INV_BLOCK:
+		block := Chain.BlockByHash(hash)
+		if block == nil {
+			return ""
+		}
+		return bc.SerializeBlock(block)
+	case INV_TRNSX:
+		tx := pendingTransaction(hash)
+		if tx == nil {
+			return ""
+		}
+		return bc.SerializeTX(tx)
+	}
+	return ""
+}
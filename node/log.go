@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	LOG_TEXT = "text"
+	LOG_JSON = "json"
+)
+
+var (
+	Log     = slog.Default().With("component", "node")
+	SyncLog = slog.Default().With("component", "sync")
+	HTTPLog = slog.Default().With("component", "http")
+)
+
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	if err != nil {
+		return level, fmt.Errorf("%q is not one of debug, info, warn, error", value)
+	}
+	return level, nil
+}
+
+func setupLogging(out io.Writer, level, format string) error {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	options := &slog.HandlerOptions{
+		Level: lvl,
+	}
+	var handler slog.Handler
+	switch format {
+	case LOG_TEXT:
+		handler = slog.NewTextHandler(out, options)
+	case LOG_JSON:
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return fmt.Errorf("%q is not one of text, json", format)
+	}
+	base := slog.New(handler)
+	slog.SetDefault(base)
+	bc.SetLogger(base)
+	nt.SetLogger(base)
+	Log = base.With("component", "node")
+	SyncLog = base.With("component", "sync")
+	HTTPLog = base.With("component", "http")
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	MEMPOOL_LIMIT = 1024
+)
+
+var (
+	ErrMempoolFull = errors.New("mempool is full")
+)
+
+type Mempool struct {
+	mutex sync.Mutex
+	txs   []*bc.Transaction
+	index map[string]*bc.Transaction
+	full  bool
+	// version changes with every change to the pending set
+	version uint64
+}
+
+func NewMempool() *Mempool {
+	return &Mempool{
+		index: make(map[string]*bc.Transaction),
+	}
+}
+
+func (pool *Mempool) Add(tx *bc.Transaction) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	hash := bc.Base64Encode(tx.CurrHash)
+	if _, ok := pool.index[hash]; ok {
+		return nil
+	}
+	if len(pool.txs) >= MEMPOOL_LIMIT {
+		return fmt.Errorf("%w: %d transactions", ErrMempoolFull, MEMPOOL_LIMIT)
+	}
+	pool.txs = append(pool.txs, tx)
+	pool.index[hash] = tx
+	pool.version++
+	return nil
+}
+
+func (pool *Mempool) Get(hash []byte) *bc.Transaction {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	tx, ok := pool.index[bc.Base64Encode(hash)]
+	if !ok {
+		return nil
+	}
+	copied := *tx
+	return &copied
+}
+
+func (pool *Mempool) Len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return len(pool.txs)
+}
+
+func (pool *Mempool) Version() uint64 {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.version
+}
+
+func (pool *Mempool) Transactions() []*bc.Transaction {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	txs := make([]*bc.Transaction, len(pool.txs))
+	copy(txs, pool.txs)
+	return txs
+}
+
+func (pool *Mempool) Clear() []*bc.Transaction {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	txs := pool.txs
+	pool.txs = nil
+	pool.index = make(map[string]*bc.Transaction)
+	pool.full = false
+	pool.version++
+	return txs
+}
+
+func (pool *Mempool) Remove(hash []byte) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	key := bc.Base64Encode(hash)
+	if _, ok := pool.index[key]; !ok {
+		return
+	}
+	delete(pool.index, key)
+	pool.version++
+	for i, tx := range pool.txs {
+		if bc.Base64Encode(tx.CurrHash) == key {
+			pool.txs = append(pool.txs[:i], pool.txs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (pool *Mempool) MarkFull() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.full = true
+}
+
+func (pool *Mempool) Full() bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if bc.Spec.TxsLimit != 0 && len(pool.txs) >= bc.Spec.TxsLimit {
+		return true
+	}
+	return pool.full && len(pool.txs) != 0
+}
+
+func buildTemplate(txs []*bc.Transaction) *bc.Block {
+	block := bc.NewBlock(User.Address(), Chain.LastHash())
+	block.Coinbase = Coinbase
+	for _, tx := range txs {
+		err := block.AddTransaction(Chain, tx)
+		if errors.Is(err, bc.ErrTxLimit) || errors.Is(err, bc.ErrBlockSize) {
+			break
+		}
+		if err != nil {
+			Log.Debug("transaction left out of template",
+				"hash", bc.Base64Encode(tx.CurrHash), "reason", err)
+		}
+	}
+	return block
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	METRICS_PREFIX = "node_"
+)
+
+const (
+	REJECT_MALFORMED = "malformed"
+	REJECT_INVALID   = "invalid"
+	REJECT_STALE     = "stale"
+)
+
+var OpcodeNames = map[int]string{
+	nt.ERRORPACK: "error",
+	ADD_BLOCK:    "add_block",
+	ADD_TRNSX:    "add_transaction",
+	GET_BLOCK:    "get_block",
+	GET_LHASH:    "get_last_hash",
+	GET_BLNCE:    "get_balance",
+	GET_CSIZE:    "get_chain_size",
+	GET_PEERS:    "get_peers",
+	GET_HDRS:     "get_headers",
+	ADD_INVNT:    "add_inventory",
+	GET_DATA:     "get_data",
+	GET_BANS:     "get_bans",
+	DEL_BANS:     "del_bans",
+	GET_TRNSX:    "get_transaction",
+	GET_HISTR:    "get_history",
+}
+
+type NodeMetrics struct {
+	mutex       sync.Mutex
+	mined       uint64
+	accepted    uint64
+	rejected    map[string]uint64
+	syncs       uint64
+	syncSeconds float64
+	lastSync    float64
+}
+
+var (
+	Metrics = NewNodeMetrics()
+)
+
+func NewNodeMetrics() *NodeMetrics {
+	return &NodeMetrics{
+		rejected: make(map[string]uint64),
+	}
+}
+
+func (metrics *NodeMetrics) BlockMined() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.mined++
+}
+
+func (metrics *NodeMetrics) BlocksAccepted(count uint64) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.accepted += count
+}
+
+func (metrics *NodeMetrics) BlockRejected(reason string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.rejected[reason]++
+}
+
+func (metrics *NodeMetrics) SyncDone(duration time.Duration) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.syncs++
+	metrics.syncSeconds += duration.Seconds()
+	metrics.lastSync = duration.Seconds()
+}
+
+var RejectReasons = []struct {
+	err    error
+	reason string
+}{
+	{bc.ErrDifficulty, "difficulty"},
+	{bc.ErrBlockSize, "size"},
+	{bc.ErrCheckpoint, "checkpoint"},
+	{bc.ErrBlockHash, "hash"},
+	{bc.ErrPrevBlock, "parent"},
+	{bc.ErrBlockSignature, "signature"},
+	{bc.ErrProof, "proof"},
+	{bc.ErrMapping, "mapping"},
+	{bc.ErrTimestamp, "timestamp"},
+	{bc.ErrTxCount, "transactions"},
+	{bc.ErrDuplicateTx, "transactions"},
+	{bc.ErrReward, "reward"},
+	{bc.ErrTxHash, "transactions"},
+	{bc.ErrTxSignature, "transactions"},
+	{bc.ErrBalance, "balance"},
+}
+
+func rejectReason(err error) string {
+	for _, item := range RejectReasons {
+		if errors.Is(err, item.err) {
+			return item.reason
+		}
+	}
+	return REJECT_INVALID
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var out strings.Builder
+
+	size := Chain.Size()
+	Mutex.Lock()
+	age := tipAge()
+	pending := Pool.Len()
+	mining := IsMining
+	Mutex.Unlock()
+
+	writeMetric(&out, "chain_height", "gauge", "Number of blocks in the local chain.", nil, float64(size))
+	writeMetric(&out, "tip_age_seconds", "gauge", "Seconds since the timestamp of the last block.", nil, age.Seconds())
+	writeMetric(&out, "pending_transactions", "gauge", "Transactions waiting in the mempool.", nil, float64(pending))
+	writeMetric(&out, "orphan_blocks", "gauge", "Blocks waiting in the orphan pool for their parent.", nil, float64(Orphans.Len()))
+	writeMetric(&out, "mining", "gauge", "Whether the node is mining right now.", nil, boolMetric(mining))
+	writeMetric(&out, "hash_rate", "gauge", "Hashes per second of the last proof of work.", nil, bc.HashRate())
+	writeMetric(&out, "nonces_tried_total", "counter", "Nonces tried by proof of work.", nil, float64(bc.NoncesTried()))
+	writeMetric(&out, "peers_known", "gauge", "Peers in the peer store.", nil, float64(len(Peers.Addresses())))
+	writeMetric(&out, "inbound_connections", "gauge", "Inbound connections being served right now.", nil, float64(nt.Connections()))
+
+	Metrics.mutex.Lock()
+	writeMetric(&out, "blocks_mined_total", "counter", "Blocks mined by this node.", nil, float64(Metrics.mined))
+	writeMetric(&out, "blocks_accepted_total", "counter", "Blocks received from peers and added to the chain.", nil, float64(Metrics.accepted))
+	var reasons []string
+	for reason := range Metrics.rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	writeHeader(&out, "blocks_rejected_total", "counter", "Blocks received from peers and rejected.")
+	for _, reason := range reasons {
+		writeSample(&out, "blocks_rejected_total", map[string]string{"reason": reason}, float64(Metrics.rejected[reason]))
+	}
+	writeMetric(&out, "sync_duration_seconds_last", "gauge", "Duration of the last completed sync.", nil, Metrics.lastSync)
+	writeHeader(&out, "sync_duration_seconds", "summary", "Duration of completed syncs.")
+	writeSample(&out, "sync_duration_seconds_sum", nil, Metrics.syncSeconds)
+	writeSample(&out, "sync_duration_seconds_count", nil, float64(Metrics.syncs))
+	Metrics.mutex.Unlock()
+
+	traffic := nt.TrafficStats()
+	var options []int
+	for option := range traffic {
+		options = append(options, option)
+	}
+	sort.Ints(options)
+	writeHeader(&out, "network_bytes_total", "counter", "Bytes sent and received per opcode.")
+	for _, option := range options {
+		name, ok := OpcodeNames[option]
+		if !ok {
+			name = fmt.Sprintf("%d", option)
+		}
+		writeSample(&out, "network_bytes_total", map[string]string{"opcode": name, "direction": "in"}, float64(traffic[option].In))
+		writeSample(&out, "network_bytes_total", map[string]string{"opcode": name, "direction": "out"}, float64(traffic[option].Out))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(out.String()))
+}
+
+func writeMetric(out *strings.Builder, name, kind, help string, labels map[string]string, value float64) {
+	writeHeader(out, name, kind, help)
+	writeSample(out, name, labels, value)
+}
+
+func writeHeader(out *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s%s %s\n", METRICS_PREFIX, name, help)
+	fmt.Fprintf(out, "# TYPE %s%s %s\n", METRICS_PREFIX, name, kind)
+}
+
+func writeSample(out *strings.Builder, name string, labels map[string]string, value float64) {
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, labels[key]))
+	}
+	if len(pairs) != 0 {
+		fmt.Fprintf(out, "%s%s{%s} %g\n", METRICS_PREFIX, name, strings.Join(pairs, ","), value)
+		return
+	}
+	fmt.Fprintf(out, "%s%s %g\n", METRICS_PREFIX, name, value)
+}
+
+func boolMetric(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
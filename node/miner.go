@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+func startMining() {
+	if !Mining || !startWorker() {
+		return
+	}
+	Mutex.Lock()
+	if IsMining || !blockDue() {
+		Mutex.Unlock()
+		Workers.Done()
+		return
+	}
+	block := buildTemplate(Pool.Transactions())
+	ctx, cancel := context.WithCancel(context.Background())
+	IsMining = true
+	CancelMining = cancel
+	Mutex.Unlock()
+	go func() {
+		defer Workers.Done()
+		defer cancel()
+		mineBlock(ctx, block)
+	}()
+}
+
+func mineBlock(ctx context.Context, block *bc.Block) {
+	Log.Info("mining started", "transactions", len(block.Transactions),
+		"coinbase", block.RewardAddress())
+	err := block.Accept(ctx, Chain, User)
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	IsMining = false
+	CancelMining = nil
+	if errors.Is(err, context.Canceled) {
+		Log.Info("mining cancelled")
+		return
+	}
+	if err != nil {
+		Log.Info("mining failed", "reason", err)
+		pruneMempool()
+		return
+	}
+	if isStopping() || !bytes.Equal(block.PrevHash, Chain.LastHash()) {
+		Log.Info("mined block is stale", "hash", bc.Base64Encode(block.CurrHash))
+		return
+	}
+	err = bc.CheckCheckpoint(Chain.Size(), block.CurrHash)
+	if err != nil {
+		Log.Info("mined block dropped", "hash", bc.Base64Encode(block.CurrHash), "reason", err)
+		return
+	}
+	Chain.AddBlock(block)
+	Log.Info("block mined", "hash", bc.Base64Encode(block.CurrHash), "height", Chain.Size()-1)
+	Metrics.BlockMined()
+	Events.PublishBlock(block, Chain.Size()-1, false)
+	pushBlockToNet(block)
+	pruneMempool()
+}
+
+func stopMining() {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	if CancelMining != nil {
+		CancelMining()
+	}
+}
+
+func produceBlocks() {
+	defer Workers.Done()
+	for !isStopping() {
+		startMining()
+		if !pause(MINING_POLL_TIME * time.Second) {
+			return
+		}
+	}
+}
+
+func blockDue() bool {
+	if Pool.Full() {
+		return true
+	}
+	return BlockTime != 0 && tipAge() >= BlockTime
+}
+
+func tipAge() time.Duration {
+	size := Chain.Size()
+	if size == 0 {
+		return 0
+	}
+	block := Chain.Block(size - 1)
+	if block == nil {
+		return 0
+	}
+	return time.Since(time.Unix(block.TimeStamp, 0))
+}
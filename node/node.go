@@ -1,21 +1,26 @@
 package main
 
-// ./node -serve::8080 -newuser:node1.key -newchain:chain1.db -loadaddr:addr.json
-// ./node -serve::9090 -newuser:node2.key -newchain:chain2.db -loadaddr:addr.json
+// ./node -listen :8080 -key node1.key -db chain1.db -addrfile addr.json
+// ./node -listen :9090 -key node2.key -db chain2.db -addrfile addr.json
+// ./node -config node.json -rpc :8545 -blocktime 30
+// ./node -listen :8080 -key node1.key -db chain1.db -genesis genesis.json -peers :9090
+// ./node -listen :7070 -key relay.key -db relay.db -peers :8080 -mining=false
+// NODE_LISTEN=:8080 NODE_KEY=node1.key NODE_DB=chain1.db NODE_PEERS=:9090 ./node
 
 import (
 	"bytes"
-	"database/sql"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
 	nt "github.com/MIHAIL33/CryptoCoin/network"
@@ -29,86 +34,106 @@ const (
 	GET_LHASH
 	GET_BLNCE
 	GET_CSIZE
+	GET_PEERS
+	GET_HDRS
+	ADD_INVNT
+	GET_DATA
+	GET_BANS
+	DEL_BANS
+	GET_TRNSX
+	GET_HISTR
 )
 
 const (
 	SEPARATOR = "_SEPARATOR_"
+	PEERS_SUFFIX = ".peers.json"
+	BANS_SUFFIX = ".bans.json"
+	DISCOVERY_TIME = 30
+	BLOCK_TIME = 60
+	MINING_POLL_TIME = 1
+	HEADERS_LIMIT = 500
+	HISTORY_LIMIT = 100
+	SYNC_WINDOW = 16
+	SYNC_PEERS = 4
+	MAX_SYNC_JOBS = 2
+	PROBE_LIMIT = 16
+	MAX_INBOUND = 128
+	MAX_PER_HOST = 32
 )
 
 var (
 	Filename string
 	Addresses []string
+	Peers *nt.PeerStore
+	Bans *nt.BanList
 	User *bc.User
 	Serve string
+	RPCAddress string
+	RemoteWork bool
 	Chain *bc.Blockchain
-	Block *bc.Block
+	Genesis *bc.Genesis
+	GenesisHash []byte
+	AssumeValid []byte
+	Pool = NewMempool()
+	Coinbase string
 	Mutex sync.Mutex
 	IsMining bool
-	BreakMining = make(chan bool)
+	Mining bool
+	BlockTime = BLOCK_TIME * time.Second
+	CancelMining context.CancelFunc
+	MaxInbound = MAX_INBOUND
+	MaxPerHost = MAX_PER_HOST
+	Probing = make(map[string]bool)
+	ProbeMutex sync.Mutex
 )
 
+var Rates = map[int]nt.Rate{
+	ADD_BLOCK: {PerSecond: 5, Burst: 20},
+	ADD_TRNSX: {PerSecond: 20, Burst: 50},
+	GET_BLOCK: {PerSecond: 100, Burst: 200},
+	GET_LHASH: {PerSecond: 20, Burst: 50},
+	GET_BLNCE: {PerSecond: 20, Burst: 50},
+	GET_PEERS: {PerSecond: 1, Burst: 10},
+	GET_HDRS:  {PerSecond: 5, Burst: 20},
+	ADD_INVNT: {PerSecond: 20, Burst: 50},
+	GET_DATA:  {PerSecond: 100, Burst: 200},
+	GET_TRNSX: {PerSecond: 20, Burst: 50},
+	GET_HISTR: {PerSecond: 20, Burst: 50},
+}
+
 
 func init() {
-	if len(os.Args) < 2 {
-		panic("failed 1")
-	}
-
-	var (
-		serveStr = ""
-		addrStr = ""
-		userNewStr = ""
-		userLoadStr = ""
-		chainNewStr = ""
-		chainLoadStr = ""
-	)
-
-	var (
-		serveExist = false
-		addrExist = false
-		userNewExist = false
-		userLoadExist = false
-		chainNewExist = false
-		chainLoadExist = false
-	)
-
-	for i := 1; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		switch {
-		case strings.HasPrefix(arg, "-serve:"):
-			serveStr = strings.Replace(arg, "-serve:", "", 1)
-			serveExist = true
-		case strings.HasPrefix(arg, "-loadaddr:"):
-			addrStr = strings.Replace(arg, "-loadaddr:", "", 1)
-			addrExist = true
-		case strings.HasPrefix(arg, "-newuser:"):
-			userNewStr = strings.Replace(arg, "-newuser:", "", 1)
-			userNewExist = true
-		case strings.HasPrefix(arg, "-loaduser:"):
-			userLoadStr = strings.Replace(arg, "-loaduser:", "", 1)
-			userLoadExist = true
-		case strings.HasPrefix(arg, "-newchain:"):
-			chainNewStr = strings.Replace(arg, "-newchain:", "", 1)
-			chainNewExist = true
-		case strings.HasPrefix(arg, "-loadchain:"):
-			chainLoadStr = strings.Replace(arg, "-loadchain:", "", 1)
-			chainLoadExist = true
+	config, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
 		}
+		os.Exit(2)
 	}
-
-	if !(userNewExist || userLoadExist) || !addrExist || !serveExist ||
-		!(chainNewExist || chainLoadExist) {
-		panic("failed 2")
-	}
-	Serve = serveStr
-	var addresses []string
-
-	err := json.Unmarshal([]byte(readFile(addrStr)), &Addresses)
+	err = setupLogging(os.Stderr, config.LogLevel, config.LogFormat)
 	if err != nil {
-		panic("failed 3")
-	}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	Serve = config.Listen
+	RPCAddress = config.RPC
+	RemoteWork = config.RemoteWork
+	Mining = config.Mining
+	bc.SetSpec(config.chainSpec)
+	bc.SetCheckpoints(config.checkpoints)
+	AssumeValid = bc.Base64Decode(config.AssumeValid)
+	if config.genesis != nil {
+		Genesis = config.genesis
+		GenesisHash = Genesis.Block().CurrHash
+	}
+	BlockTime = time.Duration(config.BlockTime) * time.Second
+	MaxInbound = config.MaxInbound
+	MaxPerHost = config.MaxPerHost
+	Rates = config.rates
+	SyncJobs = make(chan bool, config.MaxSyncJobs)
 
 	var mapaddr = make(map[string]bool)
-	for _, addr := range addresses {
+	for _, addr := range config.Peers {
 		if addr == Serve {
 			continue
 		}
@@ -118,163 +143,234 @@ func init() {
 		mapaddr[addr] = true
 		Addresses = append(Addresses, addr)
 	}
-	if userNewExist {
-		User = userNew(userNewStr)
-	}
-	if userLoadExist{
-		User = userLoad(userLoadStr)
+	if fileExists(config.Key) {
+		User = userLoad(config.Key)
+	} else {
+		User = userNew(config.Key)
 	}
 	if User == nil {
-		panic("failed 5")
+		Log.Error("cannot load or create key file", "file", config.Key)
+		os.Exit(1)
 	}
-	if chainNewExist {
-		Filename = chainNewStr
-		Chain = chainNew(chainNewStr)
-	}
-	if chainLoadExist {
-		Filename = chainLoadStr
-		Chain = chainLoad(chainLoadStr)
+	Filename = config.DB
+	if fileExists(config.DB) {
+		Chain = chainLoad(config.DB)
+	} else {
+		Chain = chainNew(config.DB)
 	}
 	if Chain == nil {
-		panic("failed 6")
+		Log.Error("cannot load or create chain database", "file", config.DB)
+		os.Exit(1)
+	}
+	Bans = nt.NewBanList(config.BanList)
+	Peers = nt.NewPeerStore(config.PeerStore)
+	for _, addr := range Addresses {
+		addPeer(addr)
+	}
+	if config.Coinbase != User.Address() {
+		Coinbase = config.Coinbase
 	}
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
 }
 
-
 func main() {
-	nt.Listen(Serve, handleServer)
-	for {
-		fmt.Scanln()
-	}
+	Listener = nt.ListenConfig(Serve, &nt.Config{
+		MaxInbound: MaxInbound,
+		MaxPerHost: MaxPerHost,
+		Rates:      Rates,
+		IsBanned:   isBannedHost,
+		Misbehave:  misbehavePackage,
+	}, handleServer)
+	if Listener == nil {
+		Log.Error("cannot listen", "address", Serve)
+		Chain.DB.Close()
+		os.Exit(EXIT_FAILURE)
+	}
+	if startWorker() {
+		go discoverPeers()
+	}
+	if startWorker() {
+		go produceBlocks()
+	}
+	if RPCAddress != "" {
+		HTTPServer = listenHTTP(RPCAddress)
+	}
+	Log.Info("node started", "address", User.Address(), "chain", bc.Spec.Name, "height", Chain.Size(),
+		"mining", Mining, "coinbase", Coinbase, "block_time", BlockTime)
+	os.Exit(waitSignal())
 }
 
 func handleServer(conn nt.Conn, pack *nt.Package) {
-	nt.Handle(ADD_BLOCK, conn, pack, addBlock)
+	host := nt.RemoteHost(conn)
+	nt.Handle(ADD_BLOCK, conn, pack, func(pack *nt.Package) string {
+		return addBlock(host, pack)
+	})
 	nt.Handle(ADD_TRNSX, conn, pack, addTransaction)
 	nt.Handle(GET_BLOCK, conn, pack, getBlock)
 	nt.Handle(GET_LHASH, conn, pack, getLastHash)
 	nt.Handle(GET_BLNCE, conn, pack, getBalance)
+	nt.Handle(GET_PEERS, conn, pack, func(pack *nt.Package) string {
+		return getPeers(host, pack)
+	})
+	nt.Handle(GET_HDRS, conn, pack, getHeaders)
+	nt.Handle(ADD_INVNT, conn, pack, func(pack *nt.Package) string {
+		return addInventory(host, pack)
+	})
+	nt.Handle(GET_DATA, conn, pack, getData)
+	nt.Handle(GET_TRNSX, conn, pack, getTransaction)
+	nt.Handle(GET_HISTR, conn, pack, getHistory)
+	if isLocal(conn) {
+		nt.Handle(GET_BANS, conn, pack, getBans)
+		nt.Handle(DEL_BANS, conn, pack, delBan)
+	}
 }
 
-func addBlock(pack *nt.Package) string {
+func addBlock(host string, pack *nt.Package) string {
 	splited := strings.Split(pack.Data, SEPARATOR)
 	if len(splited) != 3 {
+		Log.Info("block rejected", "peer", host, "reason", "malformed package")
+		return "fail"
+	}
+	if isBannedHost(host) {
+		Log.Debug("block rejected", "peer", host, "reason", "peer is banned")
+		return "fail"
+	}
+	address := peerAddress(host, splited[0])
+	num, err := strconv.ParseUint(splited[1], 10, 64)
+	if address == "" || err != nil {
+		Log.Info("block rejected", "peer", host, "reason", "malformed sender")
 		return "fail"
 	}
 	block := bc.DeserializeBlock(splited[2])
-	if !block.IsValid(Chain, Chain.Size()) {
-		currSize := Chain.Size()
-		num, err := strconv.Atoi(splited[1])
-		if err != nil {
-			return "fail"
+	if !acceptBlock(address, num, block) {
+		return "fail"
+	}
+	return "ok"
+}
+
+func acceptBlock(address string, num uint64, block *bc.Block) bool {
+	if block == nil {
+		Log.Info("block rejected", "peer", address, "reason", "malformed block")
+		Metrics.BlockRejected(REJECT_MALFORMED)
+		misbehave(address, SCORE_MALFORMED, "malformed block")
+		return false
+	}
+	if !Chain.HasBlock(block.PrevHash) {
+		return acceptOrphan(address, num, block)
+	}
+	hash := bc.Base64Encode(block.CurrHash)
+	err := block.Validate(Chain, Chain.Size())
+	if err != nil {
+		if Chain.Size() < num {
+			Log.Info("block does not extend chain, syncing", "peer", address,
+				"hash", hash, "height", Chain.Size(), "peer_height", num, "reason", err)
+			startSync(address, num)
+			return true
 		}
-		if currSize < uint64(num) {
-			go compareChains(splited[0], uint64(num))
-			return "ok"
+		if errors.Is(err, bc.ErrPrevBlock) {
+			Log.Info("block rejected", "peer", address, "hash", hash, "reason", err)
+			Metrics.BlockRejected(REJECT_STALE)
+			return false
 		}
-		return "fail"
+		Log.Info("block rejected", "peer", address, "hash", hash, "reason", err)
+		Metrics.BlockRejected(rejectReason(err))
+		misbehave(address, validationScore(err), err.Error())
+		return false
 	}
 	Mutex.Lock()
+	// another block may have been appended since validation
+	if !bytes.Equal(block.PrevHash, Chain.LastHash()) {
+		Mutex.Unlock()
+		Log.Info("block rejected", "peer", address, "hash", hash, "reason", bc.ErrPrevBlock)
+		Metrics.BlockRejected(REJECT_STALE)
+		return false
+	}
 	Chain.AddBlock(block)
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
+	height := Chain.Size() - 1
+	pruneMempool()
 	Mutex.Unlock()
+	Metrics.BlocksAccepted(1)
+	Log.Info("block accepted", "peer", address, "hash", hash, "height", height)
 
-	if IsMining {
-		BreakMining <-true
-		IsMining = false
-	}
+	stopMining()
 
-	return "ok"
+	Events.PublishBlock(block, height, false)
+	Known.Add(address, bc.Base64Encode(block.CurrHash))
+	pushBlockToNet(block)
+	connectOrphans(block.CurrHash)
+	return true
 }
 
-func compareChains(address string, num uint64) {
-	filename := "temp_" + hex.EncodeToString(bc.GenerateRandomBytes(8))
-	file, err := os.Create(filename)
-	if err != nil {
-		return
-	}
-	file.Close()
-	defer func() {
-		os.Remove(filename)
-	} ()
-
-	res := nt.Send(address, &nt.Package{
-		Option: GET_BLOCK,
-		Data: fmt.Sprintf("%d", 0),
+func pushBlockToNet(block *bc.Block) {
+	announceInventory(&Inventory{
+		Type: INV_BLOCK,
+		Hash: bc.Base64Encode(block.CurrHash),
 	})
-	if res == nil {
-		return
-	}
+}
 
-	genesis := bc.DeserializeBlock(res.Data)
-	if genesis == nil {
-		return
-	}
-	if !bytes.Equal(genesis.CurrHash, hashBlock(genesis)) {
-		return
-	}
-	db, err := sql.Open("sqlite3", filename)
-	if err != nil {
-		return
+func discoverPeers() {
+	defer Workers.Done()
+	for {
+		for _, addr := range Peers.Addresses() {
+			if isStopping() {
+				return
+			}
+			res := nt.Send(addr, &nt.Package{
+				Option: GET_PEERS,
+				Data: Serve,
+			})
+			if res == nil || res.Data == "" {
+				Peers.Fail(addr)
+				continue
+			}
+			Peers.Seen(addr)
+			if res.Option != GET_PEERS {
+				continue
+			}
+			var addresses []string
+			err := json.Unmarshal([]byte(res.Data), &addresses)
+			if err != nil {
+				continue
+			}
+			for _, newAddr := range addresses {
+				probePeer(gossipAddress(addr, newAddr))
+			}
+		}
+		Peers.Save()
+		if !pause(DISCOVERY_TIME * time.Second) {
+			return
+		}
 	}
-	defer db.Close()
+}
 
-	_, err = db.Exec(bc.CREATE_TABLE)
-	if err != nil {
+// An advertised address is only stored, and so shared with
+// other peers, once it answers a dial-back.
+func probePeer(address string) {
+	if address == "" || isSelf(address) || isBannedHost(peerHost(address)) {
 		return
 	}
-	chain := &bc.Blockchain{
-		DB: db,
+	ProbeMutex.Lock()
+	defer ProbeMutex.Unlock()
+	if Probing[address] || len(Probing) >= PROBE_LIMIT || !startWorker() {
+		return
 	}
-	chain.AddBlock(genesis)
-
-	defer func() {
-		chain.DB.Close()
-	}()
-
-	for i := uint64(1); i < num; i++ {
-		res := nt.Send(address, &nt.Package{
-			Option: GET_BLOCK,
-			Data: fmt.Sprintf("%d", i),
+	Probing[address] = true
+	go func() {
+		defer func() {
+			ProbeMutex.Lock()
+			delete(Probing, address)
+			ProbeMutex.Unlock()
+			Workers.Done()
+		}()
+		res := nt.Request(address, &nt.Package{
+			Option: GET_LHASH,
 		})
-		if res == nil {
+		if res == nil || res.Data == "" {
+			Log.Debug("peer not added", "peer", address, "reason", "dial-back failed")
 			return
 		}
-		block := bc.DeserializeBlock(res.Data)
-		if block == nil {
-			return
-		}
-		if !block.IsValid(chain, i) {
-			return
-		}
-		chain.AddBlock(block)
-	}
-	Mutex.Lock()
-	Chain.DB.Close()
-	os.Remove(Filename)
-	copyFile(filename, Filename)
-	Chain = bc.LoadChain(Filename)
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
-	Mutex.Unlock()
-	if IsMining {
-		BreakMining <- true
-		IsMining = false
-	}
-
-}
-
-func pushBlockToNet(block *bc.Block) {
-	var (
-		sblock = bc.SerializeBlock(block)
-		msg = Serve + SEPARATOR + fmt.Sprintf("%d", Chain.Size()) + SEPARATOR + sblock
-	)
-	for _, addr := range Addresses {
-		go nt.Send(addr, &nt.Package{
-			Option: ADD_BLOCK,
-			Data: msg,
-		})
-	}
+		addPeer(address)
+		Peers.Seen(address)
+	}()
 }
 
 func copyFile(src, dst string) error {
@@ -283,16 +379,25 @@ func copyFile(src, dst string) error {
 		return err
 	}
 	defer in.Close()
-	out, err := os.Create(dst)
+	temp := dst + ".tmp"
+	out, err := os.Create(temp)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer os.Remove(temp)
 	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
 	if err != nil {
+		out.Close()
 		return err
 	}
-	return out.Close()
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, dst)
 }
 
 func selectBlock(chain *bc.Blockchain, i int) string {
@@ -304,33 +409,53 @@ func selectBlock(chain *bc.Blockchain, i int) string {
 
 func addTransaction(pack *nt.Package) string {
 	var tx = bc.DeserializeTX(pack.Data)
-	if tx == nil || len(Block.Transactions) == bc.TXS_LIMIT {
+	if acceptTransaction(tx) != nil {
 		return "fail"
 	}
-	Mutex.Lock()
-	err := Block.AddTransaction(Chain, tx)
-	Mutex.Unlock()
-	if err != nil {
-		return "fail"
+	return "ok"
+}
+
+func acceptTransaction(tx *bc.Transaction) error {
+	if tx == nil {
+		Log.Info("transaction rejected", "reason", bc.ErrNilTx)
+		return bc.ErrNilTx
 	}
-	if len(Block.Transactions) == bc.TXS_LIMIT {
-		go func() {
-			Mutex.Lock()
-			block := *Block
-			IsMining = true
-			Mutex.Unlock()
-			err := (&block).Accept(Chain, User, BreakMining)
-			Mutex.Lock()
-			IsMining = false
-			if err == nil && bytes.Equal(block.PrevHash, Block.PrevHash) {
-				Chain.AddBlock(&block)
-				pushBlockToNet(&block)
-			}
-			Block = bc.NewBlock(User.Address(), Chain.LastHash())
-			Mutex.Unlock()
-		} ()
+	hash := bc.Base64Encode(tx.CurrHash)
+	if pendingTransaction(tx.CurrHash) != nil {
+		return nil
 	}
-	return "ok"
+	err := tx.Validate()
+	if err == nil {
+		Mutex.Lock()
+		err = buildTemplate(Pool.Transactions()).AddTransaction(Chain, tx)
+		if err == nil {
+			err = Pool.Add(tx)
+		}
+		if errors.Is(err, bc.ErrTxLimit) || errors.Is(err, bc.ErrBlockSize) {
+			Pool.MarkFull()
+		}
+		// the running template lacks this transaction, mine a new one
+		if err == nil && CancelMining != nil {
+			CancelMining()
+		}
+		Mutex.Unlock()
+	}
+	if err != nil {
+		Log.Info("transaction rejected", "hash", hash, "reason", err)
+		return err
+	}
+	Log.Debug("transaction accepted", "hash", hash, "sender", tx.Sender, "receiver", tx.Receiver)
+	Events.PublishTransaction(tx)
+	announceInventory(&Inventory{
+		Type: INV_TRNSX,
+		Hash: bc.Base64Encode(tx.CurrHash),
+	})
+	startMining()
+	return nil
+}
+
+func pendingTransaction(hash []byte) *bc.Transaction {
+	return Pool.Get(hash)
 }
 
 func getBlock(pack *nt.Package) string {
@@ -353,6 +478,68 @@ func getBalance(pack *nt.Package) string {
 	return fmt.Sprintf("%d", Chain.Balance(pack.Data, Chain.Size()))
 }
 
+func getHeaders(pack *nt.Package) string {
+	splited := strings.Split(pack.Data, SEPARATOR)
+	if len(splited) != 2 {
+		return ""
+	}
+	from, err := strconv.ParseUint(splited[0], 10, 64)
+	if err != nil {
+		return ""
+	}
+	count, err := strconv.ParseUint(splited[1], 10, 64)
+	if err != nil {
+		return ""
+	}
+	if count > HEADERS_LIMIT {
+		count = HEADERS_LIMIT
+	}
+	return bc.SerializeHeaders(Chain.Headers(from, count))
+}
+
+func getHistory(pack *nt.Package) string {
+	splited := strings.Split(pack.Data, SEPARATOR)
+	if len(splited) != 3 {
+		return ""
+	}
+	offset, err := strconv.ParseUint(splited[1], 10, 64)
+	if err != nil {
+		return ""
+	}
+	limit, err := strconv.ParseUint(splited[2], 10, 64)
+	if err != nil {
+		return ""
+	}
+	if limit > HISTORY_LIMIT {
+		limit = HISTORY_LIMIT
+	}
+	history := Chain.History(splited[0], offset, limit)
+	if history == nil {
+		history = []*bc.HistoryEntry{}
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func getPeers(host string, pack *nt.Package) string {
+	probePeer(peerAddress(host, pack.Data))
+	addresses := []string{}
+	for _, addr := range Peers.Addresses() {
+		addr = sharedAddress(host, addr)
+		if addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	data, err := json.Marshal(addresses)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
 func readFile(filename string) string {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -390,7 +577,11 @@ func writeFile(filename, data string) error {
 }
 
 func chainNew(filename string) *bc.Blockchain {
-	err := bc.NewChain(filename, User.Address())
+	genesis := Genesis
+	if genesis == nil {
+		genesis = bc.DefaultGenesis(User.Address())
+	}
+	err := bc.NewChain(filename, genesis)
 	if err != nil {
 		return nil
 	}
@@ -399,43 +590,23 @@ func chainNew(filename string) *bc.Blockchain {
 
 func chainLoad(filename string) *bc.Blockchain {
 	chain := bc.LoadChain(filename)
+	if chain == nil {
+		return nil
+	}
+	if GenesisHash != nil {
+		genesis := chain.Block(0)
+		if genesis == nil || !bytes.Equal(genesis.CurrHash, GenesisHash) {
+			Log.Error("chain database does not start with the configured genesis",
+				"file", filename, "genesis", bc.Base64Encode(GenesisHash))
+			chain.DB.Close()
+			return nil
+		}
+	}
+	err := chain.CheckCheckpoints()
+	if err != nil {
+		Log.Error("chain database conflicts with the configured checkpoints", "file", filename, "err", err)
+		chain.DB.Close()
+		return nil
+	}
 	return chain
 }
-
-func hashBlock(block *bc.Block) []byte {
-	var tempHash []byte
-	for _, tx := range block.Transactions {
-		tempHash = bc.HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				tx.CurrHash,
-			},
-			[]byte{},
-		))
-	}
-	var list []string
-	for hash := range block.Mapping {
-		list = append(list, hash)
-	}
-	sort.Strings(list)
-	for _, hash := range list {
-		tempHash = bc.HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				[]byte(hash),
-				bc.ToBytes(block.Mapping[hash]),
-			},
-			[]byte{},
-		))
-	}
-	return bc.HashSum(bytes.Join(
-		[][]byte{
-			tempHash,
-			bc.ToBytes(uint64(block.Difficulty)),
-			block.PrevHash,
-			[]byte(block.Miner),
-			[]byte(block.TimeStamp),
-		},
-		[]byte{},
-	))
-}
\ No newline at end of file
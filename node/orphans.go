@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	ORPHAN_LIMIT = 64
+	ORPHAN_DEPTH = 16
+	ORPHAN_TIME  = 10 * 60
+)
+
+type Orphan struct {
+	Block  *bc.Block
+	Peer   string
+	Height uint64
+	Added  time.Time
+}
+
+type OrphanPool struct {
+	mutex    sync.Mutex
+	orphans  map[string]*Orphan
+	children map[string][]string
+	order    []string
+}
+
+var (
+	Orphans     = NewOrphanPool()
+	Fetching    = make(map[string]bool)
+	OrphanMutex sync.Mutex
+)
+
+func NewOrphanPool() *OrphanPool {
+	return &OrphanPool{
+		orphans:  make(map[string]*Orphan),
+		children: make(map[string][]string),
+	}
+}
+
+func (pool *OrphanPool) Add(peer string, num uint64, block *bc.Block) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.expire()
+	hash := bc.Base64Encode(block.CurrHash)
+	if _, ok := pool.orphans[hash]; ok {
+		return false
+	}
+	if len(pool.order) >= ORPHAN_LIMIT {
+		pool.remove(pool.order[0])
+	}
+	parent := bc.Base64Encode(block.PrevHash)
+	pool.orphans[hash] = &Orphan{
+		Block:  block,
+		Peer:   peer,
+		Height: num,
+		Added:  time.Now(),
+	}
+	pool.children[parent] = append(pool.children[parent], hash)
+	pool.order = append(pool.order, hash)
+	return true
+}
+
+func (pool *OrphanPool) Has(hash []byte) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	_, ok := pool.orphans[bc.Base64Encode(hash)]
+	return ok
+}
+
+func (pool *OrphanPool) Len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return len(pool.order)
+}
+
+func (pool *OrphanPool) TakeChildren(parent []byte) []*Orphan {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.expire()
+	var (
+		list   []*Orphan
+		hashes = append([]string(nil), pool.children[bc.Base64Encode(parent)]...)
+	)
+	for _, hash := range hashes {
+		if orphan, ok := pool.orphans[hash]; ok {
+			list = append(list, orphan)
+		}
+		pool.remove(hash)
+	}
+	return list
+}
+
+func (pool *OrphanPool) expire() {
+	for len(pool.order) != 0 {
+		orphan := pool.orphans[pool.order[0]]
+		if orphan != nil && time.Since(orphan.Added) < ORPHAN_TIME*time.Second {
+			return
+		}
+		pool.remove(pool.order[0])
+	}
+}
+
+func (pool *OrphanPool) remove(hash string) {
+	orphan, ok := pool.orphans[hash]
+	if ok {
+		delete(pool.orphans, hash)
+		parent := bc.Base64Encode(orphan.Block.PrevHash)
+		siblings := pool.children[parent]
+		for i, item := range siblings {
+			if item == hash {
+				siblings = append(siblings[:i], siblings[i+1:]...)
+				break
+			}
+		}
+		if len(siblings) == 0 {
+			delete(pool.children, parent)
+		} else {
+			pool.children[parent] = siblings
+		}
+	}
+	for i, item := range pool.order {
+		if item == hash {
+			pool.order = append(pool.order[:i], pool.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func acceptOrphan(address string, num uint64, block *bc.Block) bool {
+	if !storeOrphan(address, num, block) {
+		return false
+	}
+	if num > Chain.Size()+ORPHAN_DEPTH {
+		Log.Info("peer is far ahead, syncing", "peer", address, "height", Chain.Size(), "peer_height", num)
+		startSync(address, num)
+		return true
+	}
+	if !Orphans.Has(block.PrevHash) {
+		fetchParents(address, num, block)
+	}
+	return true
+}
+
+func storeOrphan(address string, num uint64, block *bc.Block) bool {
+	if block.Header().IsGenesis() {
+		Log.Debug("orphan block ignored", "peer", address, "hash", bc.Base64Encode(block.CurrHash), "reason", "genesis block")
+		return false
+	}
+	err := block.ValidateWork()
+	if err != nil {
+		Log.Info("block rejected", "peer", address, "hash", bc.Base64Encode(block.CurrHash), "reason", err)
+		Metrics.BlockRejected(rejectReason(err))
+		// only forged work is the peer's fault, other chains are left to sync
+		if errors.Is(err, bc.ErrProof) || errors.Is(err, bc.ErrBlockHash) {
+			misbehave(address, validationScore(err), err.Error())
+		}
+		return false
+	}
+	if Orphans.Add(address, num, block) {
+		Log.Debug("orphan block stored", "peer", address, "hash", bc.Base64Encode(block.CurrHash),
+			"parent", bc.Base64Encode(block.PrevHash))
+	}
+	return true
+}
+
+// fetchParents walks back to the chain in the background, one walk
+// per peer, and falls back to a sync when the parents are not served.
+func fetchParents(address string, num uint64, block *bc.Block) {
+	OrphanMutex.Lock()
+	defer OrphanMutex.Unlock()
+	if Fetching[address] || !startWorker() {
+		return
+	}
+	Fetching[address] = true
+	go func() {
+		defer func() {
+			OrphanMutex.Lock()
+			delete(Fetching, address)
+			OrphanMutex.Unlock()
+			Workers.Done()
+		}()
+		for depth := 0; depth < ORPHAN_DEPTH && !isStopping(); depth++ {
+			parent := fetchParent(address, block)
+			if parent == nil {
+				break
+			}
+			if Chain.HasBlock(parent.PrevHash) {
+				acceptBlock(address, num, parent)
+				return
+			}
+			if parent.Header().IsGenesis() {
+				break
+			}
+			if !storeOrphan(address, num, parent) {
+				break
+			}
+			if Orphans.Has(parent.PrevHash) {
+				return
+			}
+			block = parent
+		}
+		if !isStopping() && Chain.Size() < num {
+			Log.Info("orphan parents not served, syncing", "peer", address, "height", Chain.Size(), "peer_height", num)
+			startSync(address, num)
+		}
+	}()
+}
+
+func fetchParent(address string, block *bc.Block) *bc.Block {
+	res := requestData(address, &Inventory{
+		Type: INV_BLOCK,
+		Hash: bc.Base64Encode(block.PrevHash),
+	})
+	if res == nil {
+		return nil
+	}
+	parent := bc.DeserializeBlock(res.Data)
+	if parent == nil || !bytes.Equal(parent.CurrHash, block.PrevHash) {
+		Log.Debug("orphan parent rejected", "peer", address, "hash", bc.Base64Encode(block.PrevHash))
+		return nil
+	}
+	return parent
+}
+
+func connectOrphans(parent []byte) {
+	for _, orphan := range Orphans.TakeChildren(parent) {
+		Log.Debug("connecting orphan block", "peer", orphan.Peer, "hash", bc.Base64Encode(orphan.Block.CurrHash))
+		acceptBlock(orphan.Peer, orphan.Height, orphan.Block)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	REST_LIMIT     = 20
+	REST_MAX_LIMIT = 100
+)
+
+type RESTError struct {
+	Error string `json:"error"`
+}
+
+type BlocksPage struct {
+	From   uint64       `json:"from"`
+	Limit  uint64       `json:"limit"`
+	Total  uint64       `json:"total"`
+	Blocks []*BlockInfo `json:"blocks"`
+}
+
+type AddressPage struct {
+	Address      string        `json:"address"`
+	Offset       uint64        `json:"offset"`
+	Limit        uint64        `json:"limit"`
+	Transactions []*bc.TxEntry `json:"transactions"`
+}
+
+func handleBlocks(w http.ResponseWriter, r *http.Request) {
+	if !restMethod(w, r) {
+		return
+	}
+	from, ok := queryUint(w, r, "from", 0)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+	page := &BlocksPage{
+		From:   from,
+		Limit:  limit,
+		Total:  Chain.Size(),
+		Blocks: []*BlockInfo{},
+	}
+	for i, block := range Chain.Blocks(from, limit) {
+		page.Blocks = append(page.Blocks, &BlockInfo{
+			Height: from + uint64(i),
+			Block:  block,
+		})
+	}
+	writeJSON(w, page)
+}
+
+func handleBlock(w http.ResponseWriter, r *http.Request) {
+	if !restMethod(w, r) {
+		return
+	}
+	hash := strings.TrimPrefix(r.URL.Path, "/blocks/")
+	info := lookupBlock(pathDecode(hash))
+	if info == nil {
+		restError(w, http.StatusNotFound, "block not found")
+		return
+	}
+	writeJSON(w, info)
+}
+
+func handleTransaction(w http.ResponseWriter, r *http.Request) {
+	if !restMethod(w, r) {
+		return
+	}
+	hash := strings.TrimPrefix(r.URL.Path, "/tx/")
+	info := lookupTransaction(pathDecode(hash))
+	if info == nil {
+		restError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	writeJSON(w, info)
+}
+
+func handleAddress(w http.ResponseWriter, r *http.Request) {
+	if !restMethod(w, r) {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/address/")
+	if !strings.HasSuffix(path, "/txs") {
+		restError(w, http.StatusNotFound, "not found")
+		return
+	}
+	key := pathDecode(strings.TrimSuffix(path, "/txs"))
+	if len(key) == 0 {
+		restError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	address := bc.Base64Encode(key)
+	offset, ok := queryUint(w, r, "offset", 0)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+	entries := Chain.AddressTransactions(address, offset, limit)
+	if entries == nil {
+		entries = []*bc.TxEntry{}
+	}
+	writeJSON(w, &AddressPage{
+		Address:      address,
+		Offset:       offset,
+		Limit:        limit,
+		Transactions: entries,
+	})
+}
+
+// Standard base64 may contain "//", which ServeMux cleans away,
+// so paths carry base64url and standard base64 is kept for old links.
+func pathDecode(value string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return bc.Base64Decode(value)
+	}
+	return data
+}
+
+func restMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		restError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+func restError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSON(w, &RESTError{
+		Error: message,
+	})
+}
+
+func queryUint(w http.ResponseWriter, r *http.Request, name string, def uint64) (uint64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	num, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		restError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return num, true
+}
+
+func queryLimit(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	limit, ok := queryUint(w, r, "limit", REST_LIMIT)
+	if !ok {
+		return 0, false
+	}
+	if limit == 0 || limit > REST_MAX_LIMIT {
+		restError(w, http.StatusBadRequest, "invalid limit")
+		return 0, false
+	}
+	return limit, true
+}
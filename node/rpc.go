@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	RPC_PARSE_ERROR      = -32700
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+	RPC_NOT_FOUND        = -32000
+	RPC_TX_REJECTED      = -32001
+	RPC_NO_WORK          = -32002
+	RPC_WORK_REJECTED    = -32003
+	RPC_FORBIDDEN        = -32004
+	RPC_LIMIT_EXCEEDED   = -32005
+)
+
+const (
+	RPC_VERSION = "2.0"
+	RPC_MAXBODY = (2 << 20)
+)
+
+type RPCRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+	ID      json.RawMessage   `json:"id"`
+}
+
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// A response carries either a result, null included, or an error.
+func (res *RPCResponse) MarshalJSON() ([]byte, error) {
+	if res.Error != nil {
+		return json.Marshal(&struct {
+			JSONRPC string          `json:"jsonrpc"`
+			Error   *RPCError       `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{res.JSONRPC, res.Error, res.ID})
+	}
+	type response RPCResponse
+	return json.Marshal((*response)(res))
+}
+
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type ChainInfo struct {
+	Chain      string  `json:"chain"`
+	Size       uint64  `json:"size"`
+	LastHash   string  `json:"lastHash"`
+	Difficulty uint8   `json:"difficulty"`
+	Pending    int     `json:"pending"`
+	Mining     bool    `json:"mining"`
+	HashRate   float64 `json:"hashRate"`
+	Peers      int     `json:"peers"`
+}
+
+type TransactionInfo struct {
+	Transaction   *bc.Transaction `json:"transaction"`
+	Status        string          `json:"status"`
+	BlockHash     string          `json:"blockHash,omitempty"`
+	Height        *uint64         `json:"height,omitempty"`
+	Confirmations uint64          `json:"confirmations,omitempty"`
+	Reason        string          `json:"reason,omitempty"`
+}
+
+type BlockInfo struct {
+	Height uint64    `json:"height"`
+	Block  *bc.Block `json:"block"`
+}
+
+type rpcMethod func(params []json.RawMessage) (interface{}, *RPCError)
+
+var RPCMethods map[string]rpcMethod
+
+// Work methods sign a template per call, so only local miners
+// may use them unless remote work is enabled.
+var RPCLocalMethods = map[string]bool{
+	"getBlockTemplate": true,
+	"submitWork":       true,
+}
+
+func init() {
+	RPCMethods = map[string]rpcMethod{
+		"getBlockByHeight":   rpcGetBlockByHeight,
+		"getBlockByHash":     rpcGetBlockByHash,
+		"getTransaction":     rpcGetTransaction,
+		"getBalance":         rpcGetBalance,
+		"sendRawTransaction": rpcSendRawTransaction,
+		"getChainInfo":       rpcGetChainInfo,
+		"getPeers":           rpcGetPeers,
+		"getBlockTemplate":   rpcGetBlockTemplate,
+		"submitWork":         rpcSubmitWork,
+	}
+}
+
+func handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	local := isLoopback(peerHost(r.RemoteAddr))
+	var body json.RawMessage
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, RPC_MAXBODY)).Decode(&body)
+	if err != nil {
+		writeJSON(w, rpcFail(nil, RPC_PARSE_ERROR, "parse error"))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) != 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		err = json.Unmarshal(body, &batch)
+		if err != nil || len(batch) == 0 {
+			writeJSON(w, rpcFail(nil, RPC_INVALID_REQUEST, "invalid request"))
+			return
+		}
+		var responses []*RPCResponse
+		for _, item := range batch {
+			if res := callRPC(item, local); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+	res := callRPC(body, local)
+	if res == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, res)
+}
+
+func callRPC(data json.RawMessage, local bool) *RPCResponse {
+	var req RPCRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil || req.JSONRPC != RPC_VERSION || req.Method == "" {
+		return rpcFail(req.ID, RPC_INVALID_REQUEST, "invalid request")
+	}
+	method, ok := RPCMethods[req.Method]
+	allowed := !RPCLocalMethods[req.Method] || local || RemoteWork
+	// requests without an id are notifications and get no response
+	if req.ID == nil {
+		if ok && allowed {
+			method(req.Params)
+		}
+		return nil
+	}
+	if !ok {
+		return rpcFail(req.ID, RPC_METHOD_NOT_FOUND, "method not found")
+	}
+	if !allowed {
+		return rpcFail(req.ID, RPC_FORBIDDEN, "method is only allowed from localhost")
+	}
+	result, rpcErr := method(req.Params)
+	if rpcErr != nil {
+		return &RPCResponse{
+			JSONRPC: RPC_VERSION,
+			Error:   rpcErr,
+			ID:      req.ID,
+		}
+	}
+	return &RPCResponse{
+		JSONRPC: RPC_VERSION,
+		Result:  result,
+		ID:      req.ID,
+	}
+}
+
+func rpcFail(id json.RawMessage, code int, message string) *RPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &RPCResponse{
+		JSONRPC: RPC_VERSION,
+		Error: &RPCError{
+			Code:    code,
+			Message: message,
+		},
+		ID: id,
+	}
+}
+
+func rpcParams(params []json.RawMessage, values ...interface{}) *RPCError {
+	if len(params) != len(values) {
+		return &RPCError{
+			Code:    RPC_INVALID_PARAMS,
+			Message: "invalid params",
+			Data:    "wrong number of params",
+		}
+	}
+	for i, value := range values {
+		err := json.Unmarshal(params[i], value)
+		if err != nil {
+			return &RPCError{
+				Code:    RPC_INVALID_PARAMS,
+				Message: "invalid params",
+				Data:    err.Error(),
+			}
+		}
+	}
+	return nil
+}
+
+func rpcNotFound(what string) *RPCError {
+	return &RPCError{
+		Code:    RPC_NOT_FOUND,
+		Message: what + " not found",
+	}
+}
+
+func rpcGetBlockByHeight(params []json.RawMessage) (interface{}, *RPCError) {
+	var height uint64
+	if err := rpcParams(params, &height); err != nil {
+		return nil, err
+	}
+	block := Chain.Block(height)
+	if block == nil {
+		return nil, rpcNotFound("block")
+	}
+	return &BlockInfo{
+		Height: height,
+		Block:  block,
+	}, nil
+}
+
+func rpcGetBlockByHash(params []json.RawMessage) (interface{}, *RPCError) {
+	var hash string
+	if err := rpcParams(params, &hash); err != nil {
+		return nil, err
+	}
+	info := lookupBlock(bc.Base64Decode(hash))
+	if info == nil {
+		return nil, rpcNotFound("block")
+	}
+	return info, nil
+}
+
+func lookupBlock(hash []byte) *BlockInfo {
+	height, ok := Chain.Height(hash)
+	if !ok {
+		return nil
+	}
+	block := Chain.Block(height)
+	if block == nil {
+		return nil
+	}
+	return &BlockInfo{
+		Height: height,
+		Block:  block,
+	}
+}
+
+func rpcGetTransaction(params []json.RawMessage) (interface{}, *RPCError) {
+	var hash string
+	if err := rpcParams(params, &hash); err != nil {
+		return nil, err
+	}
+	info := lookupTransaction(bc.Base64Decode(hash))
+	if info == nil {
+		return nil, rpcNotFound("transaction")
+	}
+	return info, nil
+}
+
+func rpcGetBalance(params []json.RawMessage) (interface{}, *RPCError) {
+	var address string
+	if err := rpcParams(params, &address); err != nil {
+		return nil, err
+	}
+	return Chain.Balance(address, Chain.Size()), nil
+}
+
+func rpcSendRawTransaction(params []json.RawMessage) (interface{}, *RPCError) {
+	var tx bc.Transaction
+	if err := rpcParams(params, &tx); err != nil {
+		return nil, err
+	}
+	err := acceptTransaction(&tx)
+	if err != nil {
+		return nil, &RPCError{
+			Code:    RPC_TX_REJECTED,
+			Message: "transaction rejected",
+			Data:    err.Error(),
+		}
+	}
+	return bc.Base64Encode(tx.CurrHash), nil
+}
+
+func rpcGetChainInfo(params []json.RawMessage) (interface{}, *RPCError) {
+	Mutex.Lock()
+	pending := Pool.Len()
+	mining := IsMining
+	Mutex.Unlock()
+	return &ChainInfo{
+		Chain:      bc.Spec.Name,
+		Size:       Chain.Size(),
+		LastHash:   bc.Base64Encode(Chain.LastHash()),
+		Difficulty: bc.Spec.Difficulty,
+		Pending:    pending,
+		Mining:     mining,
+		HashRate:   bc.HashRate(),
+		Peers:      len(Peers.Addresses()),
+	}, nil
+}
+
+func rpcGetPeers(params []json.RawMessage) (interface{}, *RPCError) {
+	return Peers.Peers(), nil
+}
+
+func rpcGetBlockTemplate(params []json.RawMessage) (interface{}, *RPCError) {
+	if err := rpcParams(params); err != nil {
+		return nil, err
+	}
+	work, err := newWork()
+	if err != nil {
+		return nil, &RPCError{
+			Code:    RPC_NO_WORK,
+			Message: "no work available",
+			Data:    err.Error(),
+		}
+	}
+	return work, nil
+}
+
+func rpcSubmitWork(params []json.RawMessage) (interface{}, *RPCError) {
+	var (
+		id    string
+		nonce uint64
+	)
+	if err := rpcParams(params, &id, &nonce); err != nil {
+		return nil, err
+	}
+	result, err := submitWork(id, nonce)
+	if err != nil {
+		return nil, &RPCError{
+			Code:    RPC_WORK_REJECTED,
+			Message: "work rejected",
+			Data:    err.Error(),
+		}
+	}
+	return result, nil
+}
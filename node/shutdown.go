@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	SHUTDOWN_TIME = 30
+)
+
+const (
+	EXIT_OK      = 0
+	EXIT_FAILURE = 1
+)
+
+var (
+	Listener   nt.Listener
+	HTTPServer *http.Server
+	Workers    sync.WaitGroup
+	Stopping   bool
+	StopMutex  sync.Mutex
+	Stopped    = make(chan bool)
+)
+
+func startWorker() bool {
+	StopMutex.Lock()
+	defer StopMutex.Unlock()
+	if Stopping {
+		return false
+	}
+	Workers.Add(1)
+	return true
+}
+
+func isStopping() bool {
+	StopMutex.Lock()
+	defer StopMutex.Unlock()
+	return Stopping
+}
+
+// pause sleeps like time.Sleep and reports false when the node
+// starts shutting down instead.
+func pause(duration time.Duration) bool {
+	select {
+	case <-Stopped:
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+func waitSignal() int {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	Log.Info("shutting down", "signal", sig.String())
+
+	done := make(chan int, 1)
+	go func() {
+		done <- shutdown()
+	}()
+	select {
+	case code := <-done:
+		return code
+	case sig = <-signals:
+		Log.Warn("shutdown interrupted", "signal", sig.String())
+	case <-time.After(SHUTDOWN_TIME * time.Second):
+		Log.Error("shutdown timed out", "timeout", SHUTDOWN_TIME*time.Second)
+	}
+	return EXIT_FAILURE
+}
+
+func shutdown() int {
+	code := EXIT_OK
+
+	StopMutex.Lock()
+	Stopping = true
+	close(Stopped)
+	StopMutex.Unlock()
+
+	if Listener != nil {
+		Listener.Close()
+	}
+	if HTTPServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIME*time.Second)
+		HTTPServer.Shutdown(ctx)
+		cancel()
+		closeWebSockets()
+	}
+
+	stopMining()
+	Workers.Wait()
+
+	if err := Peers.Save(); err != nil {
+		Log.Error("cannot save peers", "err", err)
+		code = EXIT_FAILURE
+	}
+	if err := Bans.Save(); err != nil {
+		Log.Error("cannot save bans", "err", err)
+		code = EXIT_FAILURE
+	}
+	Mutex.Lock()
+	err := Chain.DB.Close()
+	Mutex.Unlock()
+	if err != nil {
+		Log.Error("cannot close database", "err", err)
+		code = EXIT_FAILURE
+	}
+	Log.Info("shutdown complete", "code", code)
+	return code
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+var (
+	SyncJobs  = make(chan bool, MAX_SYNC_JOBS)
+	Syncing   = make(map[string]bool)
+	SyncMutex sync.Mutex
+)
+
+func startSync(address string, num uint64) bool {
+	SyncMutex.Lock()
+	defer SyncMutex.Unlock()
+	if Syncing[address] {
+		return false
+	}
+	select {
+	case SyncJobs <- true:
+	default:
+		return false
+	}
+	if !startWorker() {
+		<-SyncJobs
+		return false
+	}
+	Syncing[address] = true
+	go func() {
+		defer func() {
+			SyncMutex.Lock()
+			delete(Syncing, address)
+			SyncMutex.Unlock()
+			<-SyncJobs
+			Workers.Done()
+		}()
+		compareChains(address, num)
+	}()
+	return true
+}
+
+func compareChains(address string, num uint64) {
+	start := time.Now()
+	SyncLog.Info("sync started", "peer", address, "height", Chain.Size(), "peer_height", num)
+	headers := downloadHeaders(address, num)
+	if headers == nil {
+		return
+	}
+
+	filename := "temp_" + hex.EncodeToString(bc.GenerateRandomBytes(8))
+	file, err := os.Create(filename)
+	if err != nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", err)
+		return
+	}
+	file.Close()
+	defer func() {
+		os.Remove(filename)
+	}()
+
+	if GenesisHash != nil && !bytes.Equal(headers[0].CurrHash, GenesisHash) {
+		SyncLog.Info("sync aborted", "peer", address, "reason", "peer chain has a different genesis")
+		return
+	}
+	genesis := fetchBlock(address, 0, headers[0])
+	if genesis == nil {
+		SyncLog.Info("sync aborted", "peer", address, "reason", "genesis block not served")
+		return
+	}
+	err = genesis.ValidateGenesis()
+	if err != nil {
+		SyncLog.Info("sync aborted", "peer", address, "reason", err)
+		return
+	}
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", err)
+		return
+	}
+	defer db.Close()
+
+	_, err = db.Exec(bc.CREATE_TABLE)
+	if err != nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", err)
+		return
+	}
+	_, err = db.Exec(bc.CREATE_INDEX)
+	if err != nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", err)
+		return
+	}
+	chain := &bc.Blockchain{
+		DB: db,
+	}
+	chain.AddBlock(genesis)
+
+	assumed := assumedHeight(headers)
+	if assumed != 0 {
+		SyncLog.Info("skipping signature checks", "peer", address, "assume_valid", assumed)
+	}
+	peers := syncPeers(address)
+	for from := uint64(1); from < num; from += SYNC_WINDOW {
+		to := from + SYNC_WINDOW
+		if to > num {
+			to = num
+		}
+		if isStopping() {
+			SyncLog.Info("sync aborted", "peer", address, "reason", "shutting down")
+			return
+		}
+		blocks := downloadBlocks(peers, address, headers, from, to)
+		if blocks == nil {
+			SyncLog.Info("sync aborted", "peer", address, "reason", "blocks not served", "from", from, "to", to)
+			return
+		}
+		for i, block := range blocks {
+			height := from + uint64(i)
+			validate := block.Validate
+			if height <= assumed {
+				validate = block.ValidateAssumed
+			}
+			err := validate(chain, height)
+			if err != nil {
+				SyncLog.Info("block rejected", "peer", address, "hash", bc.Base64Encode(block.CurrHash),
+					"height", height, "reason", err)
+				Metrics.BlockRejected(rejectReason(err))
+				misbehave(address, validationScore(err), err.Error())
+				return
+			}
+			chain.AddBlock(block)
+		}
+		logProgress(address, "blocks", to, num)
+	}
+	if isStopping() {
+		SyncLog.Info("sync aborted", "peer", address, "reason", "shutting down")
+		return
+	}
+	db.Close()
+	synced := bc.LoadChain(filename)
+	if synced == nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", "cannot load synced chain")
+		return
+	}
+	synced.DB.Close()
+	fork := forkHeight(headers)
+	Mutex.Lock()
+	Chain.DB.Close()
+	// a failed copy leaves the old file in place, so this reopens the old chain
+	err = copyFile(filename, Filename)
+	loaded := bc.LoadChain(Filename)
+	if loaded != nil {
+		Chain = loaded
+		pruneMempool()
+	}
+	Mutex.Unlock()
+	if loaded == nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", "cannot reload chain", "file", Filename)
+		return
+	}
+	if err != nil {
+		SyncLog.Error("sync aborted", "peer", address, "reason", "cannot replace chain", "err", err)
+		return
+	}
+	Metrics.BlocksAccepted(num - fork)
+	Metrics.SyncDone(time.Since(start))
+	SyncLog.Info("sync finished", "peer", address, "height", num, "fork", fork,
+		"duration", time.Since(start))
+	stopMining()
+	for i := fork; i < num; i++ {
+		block := Chain.Block(i)
+		if block == nil {
+			break
+		}
+		Events.PublishBlock(block, i, true)
+	}
+	connectOrphans(Chain.LastHash())
+}
+
+func assumedHeight(headers []*bc.Header) uint64 {
+	if AssumeValid == nil {
+		return 0
+	}
+	for i, header := range headers {
+		if bytes.Equal(header.CurrHash, AssumeValid) {
+			return uint64(i)
+		}
+	}
+	return 0
+}
+
+func forkHeight(headers []*bc.Header) uint64 {
+	for i, header := range headers {
+		block := Chain.Block(uint64(i))
+		if block == nil || !bytes.Equal(block.CurrHash, header.CurrHash) {
+			return uint64(i)
+		}
+	}
+	return uint64(len(headers))
+}
+
+func downloadHeaders(address string, num uint64) []*bc.Header {
+	var headers []*bc.Header
+	for uint64(len(headers)) < num {
+		if isStopping() {
+			SyncLog.Info("sync aborted", "peer", address, "reason", "shutting down")
+			return nil
+		}
+		res := nt.Send(address, &nt.Package{
+			Option: GET_HDRS,
+			Data:   fmt.Sprintf("%d%s%d", len(headers), SEPARATOR, HEADERS_LIMIT),
+		})
+		if res == nil || res.Option != GET_HDRS || res.Data == "" {
+			SyncLog.Info("sync aborted", "peer", address, "reason", "headers not served", "from", len(headers))
+			return nil
+		}
+		batch := bc.DeserializeHeaders(res.Data)
+		if len(batch) == 0 {
+			SyncLog.Info("sync aborted", "peer", address, "reason", "claimed chain size not served")
+			misbehave(address, SCORE_FALSE_CHAIN, "claimed chain size not served")
+			return nil
+		}
+		for _, header := range batch {
+			size := len(headers)
+			if size == 0 && !header.IsGenesis() {
+				SyncLog.Info("header rejected", "peer", address, "height", size, "reason", "invalid genesis header")
+				misbehave(address, SCORE_INVALID_BLOCK, "invalid genesis header")
+				return nil
+			}
+			if size != 0 {
+				err := header.Validate(headers[size-1])
+				if err == nil {
+					err = bc.CheckCheckpoint(uint64(size), header.CurrHash)
+				}
+				if err != nil {
+					SyncLog.Info("header rejected", "peer", address, "height", size, "reason", err)
+					misbehave(address, validationScore(err), err.Error())
+					return nil
+				}
+			}
+			headers = append(headers, header)
+		}
+		logProgress(address, "headers", uint64(len(headers)), num)
+	}
+	return headers[:num]
+}
+
+func downloadBlocks(peers []string, origin string, headers []*bc.Header, from, to uint64) []*bc.Block {
+	var (
+		blocks = make([]*bc.Block, to-from)
+		wg     sync.WaitGroup
+	)
+	for i := from; i < to; i++ {
+		wg.Add(1)
+		go func(i uint64) {
+			defer wg.Done()
+			peer := peers[i%uint64(len(peers))]
+			block := fetchBlock(peer, i, headers[i])
+			if block == nil && peer != origin {
+				block = fetchBlock(origin, i, headers[i])
+			}
+			blocks[i-from] = block
+		}(i)
+	}
+	wg.Wait()
+	for _, block := range blocks {
+		if block == nil {
+			return nil
+		}
+	}
+	return blocks
+}
+
+func fetchBlock(address string, i uint64, header *bc.Header) *bc.Block {
+	res := nt.Request(address, &nt.Package{
+		Option: GET_BLOCK,
+		Data:   fmt.Sprintf("%d", i),
+	})
+	if res == nil {
+		return nil
+	}
+	block := bc.DeserializeBlock(res.Data)
+	if block == nil {
+		SyncLog.Debug("block rejected", "peer", address, "height", i, "reason", "malformed block")
+		return nil
+	}
+	if !bytes.Equal(block.CurrHash, header.CurrHash) {
+		SyncLog.Debug("block rejected", "peer", address, "height", i, "reason", "hash does not match header")
+		return nil
+	}
+	if !bytes.Equal(block.CurrHash, block.Hash()) {
+		SyncLog.Debug("block rejected", "peer", address, "height", i, "reason", "hash does not match contents")
+		return nil
+	}
+	return block
+}
+
+func syncPeers(origin string) []string {
+	peers := []string{origin}
+	for _, addr := range Peers.Addresses() {
+		if len(peers) == SYNC_PEERS {
+			break
+		}
+		if addr == origin || addr == Serve {
+			continue
+		}
+		peers = append(peers, addr)
+	}
+	return peers
+}
+
+func logProgress(address, stage string, done, total uint64) {
+	SyncLog.Info("sync progress", "peer", address, "stage", stage, "done", done, "total", total)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+	nt "github.com/MIHAIL33/CryptoCoin/network"
+)
+
+const (
+	TX_PENDING  = "pending"
+	TX_INCLUDED = "included"
+	TX_DROPPED  = "dropped"
+)
+
+const (
+	DROPPED_LIMIT = 1024
+)
+
+var (
+	Dropped      = make(map[string]*TransactionInfo)
+	DroppedOrder []string
+)
+
+// pruneMempool is run whenever the tip changes or a template fails:
+// transactions now in the chain leave the pool, the ones that no longer
+// fit on the tip are dropped and reported, the rest stay pending.
+func pruneMempool() {
+	Templates.Clear()
+	block := bc.NewBlock(User.Address(), Chain.LastHash())
+	for _, tx := range Pool.Transactions() {
+		found, _, _ := Chain.Transaction(tx.CurrHash)
+		if found != nil {
+			Pool.Remove(tx.CurrHash)
+			continue
+		}
+		err := tx.Validate()
+		if err == nil {
+			err = block.AddTransaction(Chain, tx)
+		}
+		if err == nil || errors.Is(err, bc.ErrTxLimit) || errors.Is(err, bc.ErrBlockSize) {
+			continue
+		}
+		Log.Info("transaction dropped", "hash", bc.Base64Encode(tx.CurrHash), "reason", err)
+		Pool.Remove(tx.CurrHash)
+		dropTransaction(tx, err)
+	}
+}
+
+func dropTransaction(tx *bc.Transaction, reason error) {
+	hash := bc.Base64Encode(tx.CurrHash)
+	if _, ok := Dropped[hash]; ok {
+		return
+	}
+	if len(DroppedOrder) >= DROPPED_LIMIT {
+		delete(Dropped, DroppedOrder[0])
+		DroppedOrder = DroppedOrder[1:]
+	}
+	info := &TransactionInfo{
+		Transaction: tx,
+		Status:      TX_DROPPED,
+		Reason:      reason.Error(),
+	}
+	Dropped[hash] = info
+	DroppedOrder = append(DroppedOrder, hash)
+	Events.PublishDropped(info)
+}
+
+func droppedTransaction(hash []byte) *TransactionInfo {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	return Dropped[bc.Base64Encode(hash)]
+}
+
+func lookupTransaction(hash []byte) *TransactionInfo {
+	if tx := pendingTransaction(hash); tx != nil {
+		return &TransactionInfo{
+			Transaction: tx,
+			Status:      TX_PENDING,
+		}
+	}
+	tx, block, height := Chain.Transaction(hash)
+	if tx != nil {
+		return &TransactionInfo{
+			Transaction:   tx,
+			Status:        TX_INCLUDED,
+			BlockHash:     bc.Base64Encode(block.CurrHash),
+			Height:        &height,
+			Confirmations: Chain.Size() - height,
+		}
+	}
+	if info := droppedTransaction(hash); info != nil {
+		return info
+	}
+	return nil
+}
+
+func getTransaction(pack *nt.Package) string {
+	info := lookupTransaction(bc.Base64Decode(pack.Data))
+	if info == nil {
+		return ""
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
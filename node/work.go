@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	bc "github.com/MIHAIL33/CryptoCoin/blockchain"
+)
+
+const (
+	TEMPLATE_LIMIT = 16
+)
+
+var (
+	ErrNoWork       = errors.New("no block is due yet")
+	ErrUnknownWork  = errors.New("unknown or expired block template")
+	ErrStaleWork    = errors.New("block template is stale")
+	ErrWorkRejected = errors.New("submitted work is invalid")
+)
+
+type BlockTemplate struct {
+	ID           string `json:"id"`
+	Height       uint64 `json:"height"`
+	PrevHash     string `json:"prevHash"`
+	Difficulty   uint8  `json:"difficulty"`
+	Target       string `json:"target"`
+	Coinbase     string `json:"coinbase"`
+	TimeStamp    int64  `json:"timeStamp"`
+	Transactions int    `json:"transactions"`
+}
+
+type WorkResult struct {
+	Hash   string `json:"hash"`
+	Height uint64 `json:"height"`
+}
+
+type TemplateStore struct {
+	mutex   sync.Mutex
+	blocks  map[string]*bc.Block
+	order   []string
+	current *BlockTemplate
+	version uint64
+}
+
+var Templates = NewTemplateStore()
+
+func NewTemplateStore() *TemplateStore {
+	return &TemplateStore{
+		blocks: make(map[string]*bc.Block),
+	}
+}
+
+func (store *TemplateStore) Add(work *BlockTemplate, block *bc.Block, version uint64) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if len(store.order) >= TEMPLATE_LIMIT {
+		delete(store.blocks, store.order[0])
+		store.order = store.order[1:]
+	}
+	store.blocks[work.ID] = block
+	store.order = append(store.order, work.ID)
+	store.current = work
+	store.version = version
+}
+
+// Current is the last template handed out while it still builds
+// on the tip with the same pending transactions.
+func (store *TemplateStore) Current(prevHash []byte, version uint64) *BlockTemplate {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	work := store.current
+	if work == nil || store.version != version || work.PrevHash != bc.Base64Encode(prevHash) {
+		return nil
+	}
+	if _, ok := store.blocks[work.ID]; !ok {
+		return nil
+	}
+	return work
+}
+
+func (store *TemplateStore) Get(id string) *bc.Block {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.blocks[id]
+}
+
+func (store *TemplateStore) Remove(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.blocks, id)
+	for i, item := range store.order {
+		if item == id {
+			store.order = append(store.order[:i], store.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (store *TemplateStore) Clear() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.blocks = make(map[string]*bc.Block)
+	store.order = nil
+	store.current = nil
+}
+
+func newWork() (*BlockTemplate, error) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	if !blockDue() {
+		return nil, ErrNoWork
+	}
+	version := Pool.Version()
+	if work := Templates.Current(Chain.LastHash(), version); work != nil {
+		return work, nil
+	}
+	block := buildTemplate(Pool.Transactions())
+	err := block.Prepare(Chain)
+	if err != nil {
+		return nil, err
+	}
+	err = block.Stamp(context.Background(), User)
+	if err != nil {
+		return nil, err
+	}
+	target := big.NewInt(1)
+	target.Lsh(target, 256-uint(block.Difficulty))
+	work := &BlockTemplate{
+		ID:           bc.Base64Encode(block.CurrHash),
+		Height:       Chain.Size(),
+		PrevHash:     bc.Base64Encode(block.PrevHash),
+		Difficulty:   block.Difficulty,
+		Target:       fmt.Sprintf("%064x", target),
+		Coinbase:     block.RewardAddress(),
+		TimeStamp:    block.TimeStamp,
+		Transactions: len(block.Transactions),
+	}
+	Templates.Add(work, block, version)
+	return work, nil
+}
+
+func submitWork(id string, nonce uint64) (*WorkResult, error) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	// the template stays available until a nonce for it is accepted
+	block := Templates.Get(id)
+	if block == nil {
+		return nil, ErrUnknownWork
+	}
+	block.Nonce = nonce
+	if !bytes.Equal(block.PrevHash, Chain.LastHash()) {
+		return nil, ErrStaleWork
+	}
+	err := block.Validate(Chain, Chain.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWorkRejected, err)
+	}
+	Chain.AddBlock(block)
+	Templates.Remove(id)
+	height := Chain.Size() - 1
+	Log.Info("block mined", "hash", id, "height", height, "external", true)
+	Metrics.BlockMined()
+	Events.PublishBlock(block, height, false)
+	pushBlockToNet(block)
+	pruneMempool()
+	if CancelMining != nil {
+		CancelMining()
+	}
+	return &WorkResult{
+		Hash:   id,
+		Height: height,
+	}, nil
+}
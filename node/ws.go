@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WS_GUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WS_MAXFRAME   = (64 << 10)
+	WS_CLOSE_TIME = 1
+)
+
+const (
+	WS_CONTINUATION = 0x0
+	WS_TEXT         = 0x1
+	WS_CLOSE        = 0x8
+	WS_PING         = 0x9
+	WS_PONG         = 0xA
+)
+
+const (
+	WS_GOING_AWAY  = 1001
+	WS_UNSUPPORTED = 1003
+)
+
+var (
+	errFrameTooLarge  = errors.New("websocket frame too large")
+	errFrameUnmasked  = errors.New("websocket frame is not masked")
+	errFrameFragments = errors.New("fragmented websocket messages are not supported")
+)
+
+var (
+	WSConns = make(map[*wsConn]bool)
+	WSMutex sync.Mutex
+)
+
+type wsConn struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	send   chan []byte
+	done   chan bool
+}
+
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	hash := sha1.Sum([]byte(key + WS_GUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	err = rw.Flush()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	ws := &wsConn{
+		conn:   conn,
+		reader: rw.Reader,
+		send:   make(chan []byte, SUB_BUFFER),
+		done:   make(chan bool),
+	}
+	WSMutex.Lock()
+	if isStopping() {
+		WSMutex.Unlock()
+		ws.close(WS_GOING_AWAY, "node is shutting down")
+		return
+	}
+	WSConns[ws] = true
+	WSMutex.Unlock()
+	go ws.writeLoop()
+	ws.readLoop()
+}
+
+// Hijacked connections are not closed by the HTTP server shutdown.
+func closeWebSockets() {
+	WSMutex.Lock()
+	defer WSMutex.Unlock()
+	for ws := range WSConns {
+		ws.close(WS_GOING_AWAY, "node is shutting down")
+	}
+}
+
+func (ws *wsConn) close(code uint16, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	ws.conn.SetWriteDeadline(time.Now().Add(WS_CLOSE_TIME * time.Second))
+	ws.writeFrame(WS_CLOSE, append(payload, reason...))
+	ws.conn.Close()
+}
+
+func (ws *wsConn) readLoop() {
+	defer func() {
+		WSMutex.Lock()
+		delete(WSConns, ws)
+		WSMutex.Unlock()
+		Events.UnsubscribeAll(ws.send)
+		close(ws.done)
+		ws.conn.Close()
+	}()
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err == errFrameFragments {
+			ws.close(WS_UNSUPPORTED, err.Error())
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case WS_TEXT:
+			ws.reply(handleSubscription(payload, ws.send))
+		case WS_PING:
+			ws.writeFrame(WS_PONG, payload)
+		case WS_CLOSE:
+			ws.writeFrame(WS_CLOSE, nil)
+			return
+		}
+	}
+}
+
+func (ws *wsConn) writeLoop() {
+	for {
+		select {
+		case data := <-ws.send:
+			err := ws.writeFrame(WS_TEXT, data)
+			if err != nil {
+				ws.conn.Close()
+				return
+			}
+		case <-ws.done:
+			return
+		}
+	}
+}
+
+func (ws *wsConn) reply(res *RPCResponse) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	select {
+	case ws.send <- data:
+	case <-ws.done:
+	}
+}
+
+func (ws *wsConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(ws.reader, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[0]&0x80 == 0 || opcode == WS_CONTINUATION {
+		return 0, nil, errFrameFragments
+	}
+	if header[1]&0x80 == 0 {
+		return 0, nil, errFrameUnmasked
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(ws.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(ws.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > WS_MAXFRAME {
+		return 0, nil, errFrameTooLarge
+	}
+	var mask [4]byte
+	_, err = io.ReadFull(ws.reader, mask[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(ws.reader, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	var (
+		length = len(payload)
+		frame  = []byte{0x80 | opcode}
+	)
+	switch {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(length))
+		frame = append(frame, 127)
+		frame = append(frame, ext[:]...)
+	}
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+func handleSubscription(data []byte, send chan []byte) *RPCResponse {
+	var req RPCRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		return rpcFail(nil, RPC_PARSE_ERROR, "parse error")
+	}
+	var params []string
+	for _, param := range req.Params {
+		var value string
+		err := json.Unmarshal(param, &value)
+		if err != nil {
+			return rpcFail(req.ID, RPC_INVALID_PARAMS, "invalid params")
+		}
+		params = append(params, value)
+	}
+	switch req.Method {
+	case "subscribe":
+		if len(params) == 0 {
+			return rpcFail(req.ID, RPC_INVALID_PARAMS, "invalid params")
+		}
+		var address string
+		switch params[0] {
+		case SUB_NEW_HEADS, SUB_PENDING_TXS:
+			if len(params) != 1 {
+				return rpcFail(req.ID, RPC_INVALID_PARAMS, "invalid params")
+			}
+		case SUB_ADDRESS:
+			if len(params) != 2 || params[1] == "" {
+				return rpcFail(req.ID, RPC_INVALID_PARAMS, "address required")
+			}
+			address = params[1]
+		default:
+			return rpcFail(req.ID, RPC_INVALID_PARAMS, "unknown subscription")
+		}
+		sub := Events.Subscribe(params[0], address, send)
+		if sub == nil {
+			return rpcFail(req.ID, RPC_LIMIT_EXCEEDED, "too many subscriptions")
+		}
+		return &RPCResponse{
+			JSONRPC: RPC_VERSION,
+			Result:  sub.ID,
+			ID:      req.ID,
+		}
+	case "unsubscribe":
+		if len(params) != 1 {
+			return rpcFail(req.ID, RPC_INVALID_PARAMS, "invalid params")
+		}
+		return &RPCResponse{
+			JSONRPC: RPC_VERSION,
+			Result:  Events.Unsubscribe(params[0], send),
+			ID:      req.ID,
+		}
+	}
+	return rpcFail(req.ID, RPC_METHOD_NOT_FOUND, "method not found")
+}